@@ -0,0 +1,233 @@
+package convai
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	FormatJSON RecordFormat = "json"
+	FormatZip  RecordFormat = "zip"
+)
+
+// AccessBundle holds everything stored about one or more super users, to answer data subject access requests
+type AccessBundle struct {
+	Manifest AccessManifest `json:"manifest"`
+
+	// Users contains the super users with their channel users, whose sessions are always populated when they exist
+	Users      []SuperUser `json:"users"`
+	Executions []Execution `json:"executions"`
+}
+
+// AccessManifest describes the contents of an AccessBundle
+type AccessManifest struct {
+	GeneratedAt  time.Time     `json:"generatedAt"`
+	SuperUserIDs []uuid.UUID   `json:"superUserIds"`
+	SuperUsers   int           `json:"superUsers"`
+	ChannelUsers int           `json:"channelUsers"`
+	Sessions     int           `json:"sessions"`
+	Executions   int           `json:"executions"`
+	Files        []ArchiveFile `json:"files,omitempty"`
+}
+
+// ArchiveFile is an entry of a zip archive, listed in the manifest so the archive can be checked for completeness
+type ArchiveFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// CollectUserData gathers a super user, their channel users and sessions, and all of their executions
+func (c *Client) CollectUserData(ctx context.Context, superUserID uuid.UUID) (*AccessBundle, error) {
+	user, err := c.GetSuperUserWithContext(ctx, superUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newAccessBundle()
+	if err := c.collectUser(ctx, bundle, *user); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// CollectUserDataByQuery is like CollectUserData for every super user matched by query
+func (c *Client) CollectUserDataByQuery(ctx context.Context, query *UserQuery) (*AccessBundle, error) {
+	bundle := newAccessBundle()
+
+	it := c.IterateUsers(ctx, query)
+	defer it.Close()
+
+	for it.Next() {
+		if err := c.collectUser(ctx, bundle, *it.User()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+func newAccessBundle() *AccessBundle {
+	return &AccessBundle{
+		Manifest: AccessManifest{
+			GeneratedAt:  time.Now().UTC(),
+			SuperUserIDs: []uuid.UUID{},
+		},
+		Users:      []SuperUser{},
+		Executions: []Execution{},
+	}
+}
+
+func (c *Client) collectUser(ctx context.Context, bundle *AccessBundle, user SuperUser) error {
+	for i := range user.ChannelUsers {
+		cu := &user.ChannelUsers[i]
+
+		if cu.Session == nil {
+			session, err := c.GetSessionWithContext(ctx, cu.ChannelId)
+			if err != nil && !IsNotFound(err) {
+				return fmt.Errorf("fetching session of channel user %s: %w", cu.ChannelId, err)
+			}
+
+			cu.Session = session
+		}
+
+		if cu.Session != nil {
+			bundle.Manifest.Sessions++
+		}
+	}
+
+	matcher := NewExecutionMatcher().
+		Where("userId").Equals(user.ID.String()).
+		SortAsc("startTime").
+		Limit(DefaultPageSize)
+
+	it := c.IterateExecutions(ctx, matcher)
+	defer it.Close()
+
+	for it.Next() {
+		bundle.Executions = append(bundle.Executions, *it.Execution())
+		bundle.Manifest.Executions++
+	}
+
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("querying executions of user %s: %w", user.ID.String(), err)
+	}
+
+	bundle.Users = append(bundle.Users, user)
+	bundle.Manifest.SuperUserIDs = append(bundle.Manifest.SuperUserIDs, user.ID)
+	bundle.Manifest.SuperUsers++
+	bundle.Manifest.ChannelUsers += len(user.ChannelUsers)
+
+	return nil
+}
+
+// WriteArchive writes the bundle to w as a single JSON document or as a zip archive
+// The zip archive contains one file per super user and one JSONL file of executions per super user,
+// described by manifest.json
+func (b *AccessBundle) WriteArchive(w io.Writer, format RecordFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+
+	case FormatZip:
+		return b.writeZip(w)
+	}
+
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+func (b *AccessBundle) writeZip(w io.Writer) error {
+	files := make(map[string][]byte)
+	var names []string
+
+	add := func(name string, data []byte) {
+		files[name] = data
+		names = append(names, name)
+	}
+
+	executions := make(map[uuid.UUID]*bytes.Buffer)
+	for _, user := range b.Users {
+		executions[user.ID] = &bytes.Buffer{}
+	}
+
+	for _, execution := range b.Executions {
+		buf, ok := executions[execution.UserID]
+		if !ok {
+			continue
+		}
+
+		if err := json.NewEncoder(buf).Encode(execution); err != nil {
+			return err
+		}
+	}
+
+	for _, user := range b.Users {
+		jsb, err := json.MarshalIndent(user, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		add(fmt.Sprintf("users/%s.json", user.ID.String()), jsb)
+		add(fmt.Sprintf("executions/%s.jsonl", user.ID.String()), executions[user.ID].Bytes())
+	}
+
+	manifest := b.Manifest
+	manifest.Files = make([]ArchiveFile, 0, len(names))
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		manifest.Files = append(manifest.Files, ArchiveFile{
+			Name:   name,
+			Size:   len(files[name]),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	zw := zip.NewWriter(w)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeZipFile(zw, "manifest.json", manifestJSON, manifest.GeneratedAt); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := writeZipFile(zw, name, files[name], manifest.GeneratedAt); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte, modified time.Time) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	return err
+}
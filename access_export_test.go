@@ -0,0 +1,120 @@
+package convai_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func TestCollectUserDataGathersEverything(t *testing.T) {
+	srv := newAudience(2)
+	defer srv.Close()
+
+	client := srv.Client()
+
+	for _, id := range []string{"cu0", "cu0", "cu1"} {
+		if _, err := client.TriggerWithContext(context.Background(), &convai.TriggerRequest{ChannelID: id, Text: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cu0, _ := srv.ChannelUser("cu0")
+
+	bundle, err := client.CollectUserData(context.Background(), cu0.SuperUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := bundle.Manifest
+	if m.SuperUsers != 1 || m.ChannelUsers != 1 || m.Sessions != 1 || m.Executions != 2 {
+		t.Fatalf("expected 1 user with 1 channel user, 1 session and 2 executions, got %+v", m)
+	}
+
+	if len(bundle.Users) != 1 || bundle.Users[0].ChannelUsers[0].Session == nil {
+		t.Fatalf("expected the user with their session, got %+v", bundle.Users)
+	}
+
+	for _, execution := range bundle.Executions {
+		if execution.UserID != cu0.SuperUserID {
+			t.Fatalf("expected only the user's executions, got one of %s", execution.UserID)
+		}
+	}
+}
+
+func TestAccessArchiveMatchesManifest(t *testing.T) {
+	srv := newAudience(1)
+	defer srv.Close()
+
+	client := srv.Client()
+
+	if _, err := client.TriggerWithContext(context.Background(), &convai.TriggerRequest{ChannelID: "cu0", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cu0, _ := srv.ChannelUser("cu0")
+
+	bundle, err := client.CollectUserData(context.Background(), cu0.SuperUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.WriteArchive(&buf, convai.FormatZip); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var manifest convai.AccessManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	id := cu0.SuperUserID.String()
+	want := []string{"users/" + id + ".json", "executions/" + id + ".jsonl"}
+
+	if len(manifest.Files) != len(want) {
+		t.Fatalf("expected the manifest to list %v, got %+v", want, manifest.Files)
+	}
+
+	for i, file := range manifest.Files {
+		sum := sha256.Sum256(files[file.Name])
+		if file.Name != want[i] || file.Size != len(files[file.Name]) || file.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Fatalf("expected %s to match its manifest entry %+v", want[i], file)
+		}
+	}
+
+	var user convai.SuperUser
+	if err := json.Unmarshal(files[want[0]], &user); err != nil || user.ID != cu0.SuperUserID {
+		t.Fatalf("expected the user's file to hold the user, got %+v: %v", user, err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(files[want[1]])), "\n"); len(lines) != 1 {
+		t.Fatalf("expected a line per execution, got %d", len(lines))
+	}
+}
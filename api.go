@@ -2,7 +2,7 @@ package convai
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -15,249 +15,592 @@ type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	userAgent  string
+	headers    http.Header
+
+	codec       Codec
+	gzip        bool
+	gzipMinSize int
+	retryPolicy RetryPolicy
+	limiters    map[EndpointGroup]*tokenBucket
+	middleware  []Middleware
+	breakers    *breakerSet
+
+	idempotencyStore IdempotencyStore
 }
 
-type APIError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
+const (
+	DefaultBaseURL   = "https://api.convai.dev/api/v1"
+	DefaultTimeout   = 15 * time.Second
+	DefaultUserAgent = "convai-sdk-go"
+)
 
-func (a *APIError) Error() string {
-	return fmt.Sprintf("%d: %s", a.Code, a.Message)
-}
+// NewClient creates an API client authenticated with apiKey, applying opts on top of the defaults
+func NewClient(apiKey string, opts ...Option) *Client {
+	o := clientOptions{
+		baseURL:   DefaultBaseURL,
+		timeout:   DefaultTimeout,
+		userAgent: DefaultUserAgent,
+		headers:   http.Header{},
+		codec:     JSONCodec,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	httpClient := &http.Client{Timeout: o.timeout}
+	if o.httpClient != nil {
+		// Copy the caller's client so that WithTimeout does not modify it
+		hc := *o.httpClient
+		if o.timeoutSet {
+			hc.Timeout = o.timeout
+		}
+		httpClient = &hc
+	}
+
+	limiters := make(map[EndpointGroup]*tokenBucket)
+	for group, limit := range o.rateLimits {
+		limiters[group] = newTokenBucket(limit)
+	}
+
+	var breakers *breakerSet
+	if o.circuitBreaker != nil {
+		breakers = newBreakerSet(*o.circuitBreaker)
+	}
 
-func NewAPIClient(apiKey string) *Client {
 	return &Client{
-		baseURL: "https://api.convai.dev/api/v1",
-		apiKey:  apiKey,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+		baseURL:    o.baseURL,
+		apiKey:     apiKey,
+		httpClient: httpClient,
+		userAgent:  o.userAgent,
+		headers:    o.headers,
+
+		codec:       o.codec,
+		gzip:        o.gzip,
+		gzipMinSize: o.gzipMinSize,
+		retryPolicy: o.retryPolicy,
+		limiters:    limiters,
+		breakers:    breakers,
+
+		idempotencyStore: o.idempotencyStore,
 	}
 }
 
+func NewAPIClient(apiKey string) *Client {
+	return NewClient(apiKey)
+}
+
 func NewCustomAPIClient(apiKey string, baseURL string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+	return NewClient(apiKey, WithBaseURL(baseURL))
+}
+
+func (c *Client) makeRequestWithBody(ctx context.Context, endpoint, method, url string, body interface{}, out interface{}) error {
+	call := &Call{
+		Context:  ctx,
+		Endpoint: endpoint,
+		Method:   method,
+		Path:     url,
+		Body:     body,
+		Header:   http.Header{},
+		out:      out,
+	}
+
+	setIdempotencyKey(call)
+
+	var doer Doer = DoerFunc(c.send)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		doer = c.middleware[i](doer)
 	}
+
+	_, err := doer.Do(call)
+	return err
 }
 
-func (c *Client) makeRequestWithBody(method, url string, body interface{}, out interface{}) (*APIError, error) {
-	jsb, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
+// send performs a call, it sits at the end of the middleware chain
+func (c *Client) send(call *Call) (*CallResult, error) {
+	if result, ok, err := c.replayIdempotent(call); ok || err != nil {
+		return result, err
 	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.baseURL, url), bytes.NewReader(jsb))
-	if err != nil {
-		return nil, err
+	var (
+		cb         *breaker
+		generation int
+	)
+
+	if c.breakers != nil {
+		cb = c.breakers.get(call.Endpoint)
+
+		var err error
+		if generation, err = cb.allow(); err != nil {
+			return nil, err
+		}
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
-	req.Header.Add("Content-Type", "application/json")
+	result, err := c.exchange(call)
 
-	res, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	if cb != nil {
+		failed, counted := breakerOutcome(call.Context, err)
+		cb.record(generation, failed, counted)
 	}
 
-	defer res.Body.Close()
+	if err == nil {
+		c.rememberIdempotent(call)
+	}
+
+	return result, err
+}
 
-	rsb, err := ioutil.ReadAll(res.Body)
+// exchange encodes a call and sends it, retrying as the retry policy allows, then decodes the response
+func (c *Client) exchange(call *Call) (*CallResult, error) {
+	ctx, method, url := call.Context, call.Method, call.Path
+
+	var err error
+
+	// Requests without a body, such as GET and DELETE, are sent without one rather than as an encoded nil
+	var reqBody []byte
+	if call.Body != nil {
+		reqBody, err = c.codec.Marshal(call.Body)
+		if err != nil {
+			return nil, &EncodeError{Method: method, Path: url, Err: err}
+		}
+	}
+
+	reqBody, gzipped, err := c.compress(reqBody)
 	if err != nil {
-		return nil, err
+		return nil, &EncodeError{Method: method, Path: url, Err: err}
 	}
 
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		var resErr APIError
+	var (
+		res      *http.Response
+		rsb      []byte
+		attempts int
+	)
+
+	limiter := c.limiters[endpointGroup(url)]
+
+	for {
+		attempts++
 
-		err = json.Unmarshal(rsb, &resErr)
+		// A request that could not wait for its turn was never sent, the error is the limit or the ctx's error
+		if limiter != nil {
+			if err := limiter.wait(ctx); err != nil {
+				return nil, &TransportError{Method: method, Path: url, Err: err}
+			}
+		}
+
+		req, err := c.newRequest(ctx, method, url, reqBody, call.Header)
 		if err != nil {
 			return nil, err
 		}
 
-		return &resErr, nil
-	} else {
-		err = json.Unmarshal(rsb, out)
-		if err != nil {
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		res, rsb, err = c.do(req)
+
+		retryable := attempts < c.retryPolicy.MaxAttempts && isRetryableRequest(req, url, call.generatedKey)
+		if err == nil && (!retryable || !isRetryableStatus(res.StatusCode)) {
+			break
+		}
+
+		if err != nil && (!retryable || ctx.Err() != nil || !isRetryableError(err)) {
+			err = &TransportError{Method: method, Path: url, Err: err}
+			if attempts > 1 {
+				return nil, &RetryError{Attempts: attempts, Err: err}
+			}
 			return nil, err
 		}
 
-		return nil, nil
+		delay := c.retryPolicy.backoff(attempts)
+		if res != nil {
+			if d, ok := retryAfter(res.Header); ok {
+				delay = d
+			}
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, &RetryError{Attempts: attempts, Err: &TransportError{Method: method, Path: url, Err: err}}
+		}
+	}
+
+	requestID := res.Header.Get("X-Request-Id")
+
+	result := &CallResult{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Attempts:   attempts,
+	}
+
+	codec := c.responseCodec(res.Header.Get("Content-Type"))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var resErr APIError
+
+		// Error bodies are not always JSON, e.g. when a proxy in front of the API fails
+		if codec.Unmarshal(rsb, &resErr) != nil || resErr.Message == "" {
+			resErr.Message = http.StatusText(res.StatusCode)
+		}
+
+		if resErr.Code == 0 {
+			resErr.Code = res.StatusCode
+		}
+
+		resErr.StatusCode = res.StatusCode
+		resErr.RequestID = requestID
+		resErr.Body = bodySnippet(rsb)
+		resErr.Attempts = attempts
+
+		return result, &resErr
+	}
+
+	err = codec.Unmarshal(rsb, call.out)
+	if err != nil {
+		return result, &DecodeError{
+			StatusCode: res.StatusCode,
+			RequestID:  requestID,
+			Body:       bodySnippet(rsb),
+			Err:        err,
+		}
+	}
+
+	result.Body = call.out
+
+	return result, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, url string, body []byte, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.baseURL, url), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	for key, values := range c.headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", c.codec.ContentType())
+	}
+	req.Header.Set("Accept", c.accept())
+
+	if c.gzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	return req, nil
+}
+
+// do sends req and reads the full response body
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer res.Body.Close()
+
+	body, err := decompressBody(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rsb, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	return res, rsb, nil
 }
 
 // Function to create a Super User and associated channel users
-func (c *Client) CreateSuperUser(request *CreateCombinedUserRequest) (*CreateCombinedUserResult, *APIError) {
+func (c *Client) CreateSuperUser(request *CreateCombinedUserRequest) (*CreateCombinedUserResult, error) {
+	return c.CreateSuperUserWithContext(context.Background(), request)
+}
+
+// CreateSuperUserWithContext is like CreateSuperUser, but the request is bound to ctx
+func (c *Client) CreateSuperUserWithContext(ctx context.Context, request *CreateCombinedUserRequest) (*CreateCombinedUserResult, error) {
 	var res CreateCombinedUserResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/users/super/create", request, &res)
+	err := c.makeRequestWithBody(ctx, "CreateSuperUser", "POST", "/users/super/create", request, &res)
 	if err != nil {
-		return nil, &APIError{Code:500, Message: fmt.Sprintf("SDK error: %s", err.Error())}
-	} else if apiErr != nil {
-		return nil, apiErr
+		return nil, err
 	}
 
 	return &res, nil
 }
 
 // Function to create Channel Users for an existing super user
-func (c *Client) CreateChannelUsers(request *CreateChannelUsersRequest) (*CreateChannelUsersResult, *APIError) {
+func (c *Client) CreateChannelUsers(request *CreateChannelUsersRequest) (*CreateChannelUsersResult, error) {
+	return c.CreateChannelUsersWithContext(context.Background(), request)
+}
+
+// CreateChannelUsersWithContext is like CreateChannelUsers, but the request is bound to ctx
+func (c *Client) CreateChannelUsersWithContext(ctx context.Context, request *CreateChannelUsersRequest) (*CreateChannelUsersResult, error) {
 	var res CreateChannelUsersResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/users/channel/create", request, &res)
+	err := c.makeRequestWithBody(ctx, "CreateChannelUsers", "POST", "/users/channel/create", request, &res)
 	if err != nil {
-		return nil, &APIError{Code:500, Message: fmt.Sprintf("SDK error: %s", err.Error())}
-	} else if apiErr != nil {
-		return nil, apiErr
+		return nil, err
 	}
 
 	return &res, nil
 }
 
 func (c *Client) QueryExecutions(matcher *ExecutionMatcher) (*ExecutionQueryResult, error) {
+	return c.QueryExecutionsWithContext(context.Background(), matcher)
+}
+
+// QueryExecutionsWithContext is like QueryExecutions, but the request is bound to ctx
+func (c *Client) QueryExecutionsWithContext(ctx context.Context, matcher *ExecutionMatcher) (*ExecutionQueryResult, error) {
 	var res ExecutionQueryResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/executions/query", matcher, &res)
+	err := c.makeRequestWithBody(ctx, "QueryExecutions", "POST", "/executions/query", matcher, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetExecution fetches a single execution by its ID
+func (c *Client) GetExecution(id uuid.UUID) (*Execution, error) {
+	return c.GetExecutionWithContext(context.Background(), id)
+}
+
+// GetExecutionWithContext is like GetExecution, but the request is bound to ctx
+func (c *Client) GetExecutionWithContext(ctx context.Context, id uuid.UUID) (*Execution, error) {
+	var res Execution
+
+	err := c.makeRequestWithBody(ctx, "GetExecution", "GET", fmt.Sprintf("/executions/%s", id.String()), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) Trigger(req *TriggerRequest) (*Execution, error) {
+	return c.TriggerWithContext(context.Background(), req)
+}
+
+// TriggerWithContext is like Trigger, but the request is bound to ctx
+func (c *Client) TriggerWithContext(ctx context.Context, req *TriggerRequest) (*Execution, error) {
 	var res Execution
 
-	apiErr, err := c.makeRequestWithBody("POST", "/executions/trigger", req, &res)
+	err := c.makeRequestWithBody(ctx, "Trigger", "POST", "/executions/trigger", req, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) Broadcast(input *BroadcastInput) (*BroadcastResult, error) {
+	return c.BroadcastWithContext(context.Background(), input)
+}
+
+// BroadcastWithContext is like Broadcast, but the request is bound to ctx
+func (c *Client) BroadcastWithContext(ctx context.Context, input *BroadcastInput) (*BroadcastResult, error) {
 	var res BroadcastResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/executions/broadcast", input, &res)
+	err := c.makeRequestWithBody(ctx, "Broadcast", "POST", "/executions/broadcast", input, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) QueryUsers(query *UserQuery) (*UserQueryResult, error) {
+	return c.QueryUsersWithContext(context.Background(), query)
+}
+
+// QueryUsersWithContext is like QueryUsers, but the request is bound to ctx
+func (c *Client) QueryUsersWithContext(ctx context.Context, query *UserQuery) (*UserQueryResult, error) {
 	var res UserQueryResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/users/super/query", query, &res)
+	err := c.makeRequestWithBody(ctx, "QueryUsers", "POST", "/users/super/query", query, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) QueryUsersReachable(query *UserQuery) (*ReachableUserResult, error) {
+	return c.QueryUsersReachableWithContext(context.Background(), query)
+}
+
+// QueryUsersReachableWithContext is like QueryUsersReachable, but the request is bound to ctx
+func (c *Client) QueryUsersReachableWithContext(ctx context.Context, query *UserQuery) (*ReachableUserResult, error) {
 	var res ReachableUserResult
 
-	apiErr, err := c.makeRequestWithBody("POST", "/users/super/query/reachable", query, &res)
+	err := c.makeRequestWithBody(ctx, "QueryUsersReachable", "POST", "/users/super/query/reachable", query, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) MergeUsers(req *MergeUsersRequest) (*SuperUser, error) {
+	return c.MergeUsersWithContext(context.Background(), req)
+}
+
+// MergeUsersWithContext is like MergeUsers, but the request is bound to ctx
+func (c *Client) MergeUsersWithContext(ctx context.Context, req *MergeUsersRequest) (*SuperUser, error) {
 	var res SuperUser
 
-	apiErr, err := c.makeRequestWithBody("POST", "/users/super/merge", req, &res)
+	err := c.makeRequestWithBody(ctx, "MergeUsers", "POST", "/users/super/merge", req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetSuperUser fetches a super user and their channel users
+func (c *Client) GetSuperUser(id uuid.UUID) (*SuperUser, error) {
+	return c.GetSuperUserWithContext(context.Background(), id)
+}
+
+// GetSuperUserWithContext is like GetSuperUser, but the request is bound to ctx
+func (c *Client) GetSuperUserWithContext(ctx context.Context, id uuid.UUID) (*SuperUser, error) {
+	var res SuperUser
+
+	err := c.makeRequestWithBody(ctx, "GetSuperUser", "GET", fmt.Sprintf("/users/super/%s", id.String()), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) DeleteSuperUser(id uuid.UUID) (*SuperUser, error) {
+	return c.DeleteSuperUserWithContext(context.Background(), id)
+}
+
+// DeleteSuperUserWithContext is like DeleteSuperUser, but the request is bound to ctx
+func (c *Client) DeleteSuperUserWithContext(ctx context.Context, id uuid.UUID) (*SuperUser, error) {
 	var res SuperUser
 
-	apiErr, err := c.makeRequestWithBody("DELETE", fmt.Sprintf("/users/super/%s", id.String()), nil, &res)
+	err := c.makeRequestWithBody(ctx, "DeleteSuperUser", "DELETE", fmt.Sprintf("/users/super/%s", id.String()), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) UpdateUserData(superUserId string, input *UpdateUserDataInput) (*SuperUser, error) {
+	return c.UpdateUserDataWithContext(context.Background(), superUserId, input)
+}
+
+// UpdateUserDataWithContext is like UpdateUserData, but the request is bound to ctx
+func (c *Client) UpdateUserDataWithContext(ctx context.Context, superUserId string, input *UpdateUserDataInput) (*SuperUser, error) {
 	var res SuperUser
 
-	apiErr, err := c.makeRequestWithBody("PUT", fmt.Sprintf("/users/super/%s", superUserId), input, &res)
+	err := c.makeRequestWithBody(ctx, "UpdateUserData", "PUT", fmt.Sprintf("/users/super/%s", superUserId), input, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetChannelUser fetches a single channel user
+func (c *Client) GetChannelUser(userID string) (*ChannelUser, error) {
+	return c.GetChannelUserWithContext(context.Background(), userID)
+}
+
+// GetChannelUserWithContext is like GetChannelUser, but the request is bound to ctx
+func (c *Client) GetChannelUserWithContext(ctx context.Context, userID string) (*ChannelUser, error) {
+	var res ChannelUser
+
+	err := c.makeRequestWithBody(ctx, "GetChannelUser", "GET", fmt.Sprintf("/users/channel/%s", userID), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) DeleteChannelUser(userID string) (*ChannelUser, error) {
+	return c.DeleteChannelUserWithContext(context.Background(), userID)
+}
+
+// DeleteChannelUserWithContext is like DeleteChannelUser, but the request is bound to ctx
+func (c *Client) DeleteChannelUserWithContext(ctx context.Context, userID string) (*ChannelUser, error) {
 	var res ChannelUser
 
-	apiErr, err := c.makeRequestWithBody("DELETE", fmt.Sprintf("/users/channel/%s", userID), nil, &res)
+	err := c.makeRequestWithBody(ctx, "DeleteChannelUser", "DELETE", fmt.Sprintf("/users/channel/%s", userID), nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetSession fetches the session of a channel user
+func (c *Client) GetSession(userID string) (*Session, error) {
+	return c.GetSessionWithContext(context.Background(), userID)
+}
+
+// GetSessionWithContext is like GetSession, but the request is bound to ctx
+func (c *Client) GetSessionWithContext(ctx context.Context, userID string) (*Session, error) {
+	var res Session
+
+	err := c.makeRequestWithBody(ctx, "GetSession", "GET", fmt.Sprintf("/users/session/%s", userID), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) UpdateSession(userID string, input *UpdateUserDataInput) (*Session, error) {
+	return c.UpdateSessionWithContext(context.Background(), userID, input)
+}
+
+// UpdateSessionWithContext is like UpdateSession, but the request is bound to ctx
+func (c *Client) UpdateSessionWithContext(ctx context.Context, userID string, input *UpdateUserDataInput) (*Session, error) {
 	var res Session
 
-	apiErr, err := c.makeRequestWithBody("PUT", fmt.Sprintf("/users/session/%s", userID), input, &res)
+	err := c.makeRequestWithBody(ctx, "UpdateSession", "PUT", fmt.Sprintf("/users/session/%s", userID), input, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
 }
 
 func (c *Client) DeleteSession(userID string) (*Session, error) {
+	return c.DeleteSessionWithContext(context.Background(), userID)
+}
+
+// DeleteSessionWithContext is like DeleteSession, but the request is bound to ctx
+func (c *Client) DeleteSessionWithContext(ctx context.Context, userID string) (*Session, error) {
 	var res Session
 
-	apiErr, err := c.makeRequestWithBody("DELETE", fmt.Sprintf("/users/session/%s", userID), nil, &res)
+	err := c.makeRequestWithBody(ctx, "DeleteSession", "DELETE", fmt.Sprintf("/users/session/%s", userID), nil, &res)
 	if err != nil {
 		return nil, err
-	} else if apiErr != nil {
-		return nil, apiErr
 	}
 
 	return &res, nil
-}
\ No newline at end of file
+}
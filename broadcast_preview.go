@@ -0,0 +1,102 @@
+package convai
+
+import (
+	"context"
+)
+
+// BroadcastPreviewOptions configures PreviewBroadcast
+type BroadcastPreviewOptions struct {
+	// SampleSize is the number of recipients included in the preview, defaults to 10
+	SampleSize int
+
+	// MaxScan limits how many users are walked to build the per channel breakdown, 0 walks the whole audience
+	MaxScan int
+}
+
+// BroadcastRecipient is a user that would receive a broadcast
+type BroadcastRecipient struct {
+	User SuperUser `json:"user"`
+
+	// ChannelUsers are the user's channel users on the broadcast channel
+	ChannelUsers []ChannelUser `json:"channelUsers"`
+
+	// ContextModifier is applied to the recipient's context when the broadcast is sent
+	ContextModifier *ContextModifier `json:"contextModifier"`
+}
+
+// BroadcastPreview describes who a broadcast would reach, without sending it
+type BroadcastPreview struct {
+	// Reachable is the count reported by QueryUsersReachable for the broadcast's query
+	Reachable uint64 `json:"reachable"`
+
+	// ByChannel counts the channel users the broadcast would trigger per channel, so a user with two channel users
+	// on a channel counts twice. When the broadcast has a channel, it is the only one counted
+	ByChannel map[string]int `json:"byChannel"`
+
+	// Scanned is the number of users walked to build ByChannel, Partial is set when MaxScan cut the walk short
+	Scanned int  `json:"scanned"`
+	Partial bool `json:"partial"`
+
+	Sample []BroadcastRecipient `json:"sample"`
+}
+
+// PreviewBroadcast performs a dry run of a broadcast, reporting its audience without sending anything
+func (c *Client) PreviewBroadcast(ctx context.Context, input *BroadcastInput, opts *BroadcastPreviewOptions) (*BroadcastPreview, error) {
+	if opts == nil {
+		opts = &BroadcastPreviewOptions{}
+	}
+
+	sampleSize := opts.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = 10
+	}
+
+	query := input.UserQuery
+
+	reachable, err := c.QueryUsersReachableWithContext(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &BroadcastPreview{
+		Reachable: reachable.Count,
+		ByChannel: make(map[string]int),
+		Sample:    []BroadcastRecipient{},
+	}
+
+	it := c.IterateUsers(ctx, &query).Prefetch()
+	defer it.Close()
+
+	// The broadcast only reaches the query's Limit users from its Offset, so the walk stops there as well
+	for (query.Limit <= 0 || preview.Scanned < query.Limit) && it.Next() {
+		if opts.MaxScan > 0 && preview.Scanned >= opts.MaxScan {
+			preview.Partial = true
+			break
+		}
+
+		user := it.User()
+		preview.Scanned++
+
+		var targeted []ChannelUser
+		for _, cu := range user.ChannelUsers {
+			if input.Channel == "" || cu.Channel == input.Channel {
+				targeted = append(targeted, cu)
+				preview.ByChannel[cu.Channel]++
+			}
+		}
+
+		if len(targeted) > 0 && len(preview.Sample) < sampleSize {
+			preview.Sample = append(preview.Sample, BroadcastRecipient{
+				User:            *user,
+				ChannelUsers:    targeted,
+				ContextModifier: input.ContextModifier,
+			})
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
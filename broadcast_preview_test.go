@@ -0,0 +1,58 @@
+package convai_test
+
+import (
+	"context"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+func TestPreviewBroadcastCountsTargetedChannelUsers(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{
+		{ChannelId: "cu1", Channel: "sms"},
+		{ChannelId: "cu2", Channel: "sms"},
+		{ChannelId: "cu3", Channel: "web"},
+	}})
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu4", Channel: "web"}}})
+
+	preview, err := srv.Client().PreviewBroadcast(context.Background(), &convai.BroadcastInput{Channel: "sms"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(preview.ByChannel) != 1 || preview.ByChannel["sms"] != 2 {
+		t.Fatalf("expected only the 2 sms channel users to be counted, got %v", preview.ByChannel)
+	}
+
+	if len(preview.Sample) != 1 || len(preview.Sample[0].ChannelUsers) != 2 {
+		t.Fatalf("expected 1 recipient with 2 channel users, got %+v", preview.Sample)
+	}
+
+	if len(srv.Executions()) != 0 {
+		t.Fatal("expected the preview not to send anything")
+	}
+}
+
+func TestPreviewBroadcastStopsAtLimit(t *testing.T) {
+	srv := newAudience(4)
+	defer srv.Close()
+
+	input := &convai.BroadcastInput{Channel: "sms", UserQuery: convai.UserQuery{Offset: 1, Limit: 2}}
+
+	preview, err := srv.Client().PreviewBroadcast(context.Background(), input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Scanned != 2 || preview.Partial || preview.ByChannel["sms"] != 2 {
+		t.Fatalf("expected the 2 users within the limit to be scanned, got %+v", preview)
+	}
+
+	if len(preview.Sample) != 2 || preview.Sample[0].ChannelUsers[0].ChannelId != "cu1" || preview.Sample[1].ChannelUsers[0].ChannelId != "cu2" {
+		t.Fatalf("expected cu1 and cu2 in the sample, got %+v", preview.Sample)
+	}
+}
@@ -0,0 +1,422 @@
+package convai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrJobNotFound is returned by a JobStore when a scheduled broadcast does not exist
+var ErrJobNotFound = errors.New("scheduled broadcast not found")
+
+// ScheduledBroadcast is a broadcast that is sent at a fixed time or on a cron schedule
+type ScheduledBroadcast struct {
+	ID    string         `json:"id"`
+	Input BroadcastInput `json:"input"`
+
+	// Cron is a standard five field cron expression evaluated in UTC, At is used for one off broadcasts instead
+	Cron string     `json:"cron,omitempty"`
+	At   *time.Time `json:"at,omitempty"`
+
+	// NextRun is when the broadcast is due next, it is zero once a one off broadcast has been sent
+	NextRun   time.Time      `json:"nextRun"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Runs      []BroadcastRun `json:"runs"`
+}
+
+// Done reports whether the broadcast will not run again
+func (s *ScheduledBroadcast) Done() bool {
+	return s.NextRun.IsZero()
+}
+
+// BroadcastRun records a single send of a scheduled broadcast
+type BroadcastRun struct {
+	ScheduledAt time.Time        `json:"scheduledAt"`
+	StartedAt   time.Time        `json:"startedAt"`
+	Result      *BroadcastResult `json:"result,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// JobStore persists scheduled broadcasts so that they survive restarts
+// Get and Delete return ErrJobNotFound for a job that does not exist
+type JobStore interface {
+	List(ctx context.Context) ([]*ScheduledBroadcast, error)
+	Get(ctx context.Context, id string) (*ScheduledBroadcast, error)
+	Save(ctx context.Context, job *ScheduledBroadcast) error
+	Delete(ctx context.Context, id string) error
+}
+
+// BroadcastScheduler sends broadcasts at future times or on cron schedules
+// Broadcasts that became due while the scheduler was not running are sent once when it starts,
+// missed cron runs are not sent individually
+type BroadcastScheduler struct {
+	client *Client
+	store  JobStore
+
+	// MaxRunsKept limits the run history kept per broadcast, defaults to 50
+	MaxRunsKept int
+
+	// PollInterval is the longest the scheduler sleeps before checking the store again, a minute when it is not
+	// positive. This picks up broadcasts added to a shared store by other processes
+	PollInterval time.Duration
+
+	// OnError is called when reading or writing the store fails, the scheduler keeps running and tries again on
+	// its next poll. Errors are ignored when it is nil
+	OnError func(err error)
+
+	wake chan struct{}
+}
+
+// NewBroadcastScheduler creates a scheduler that sends broadcasts with client and keeps them in store
+func NewBroadcastScheduler(client *Client, store JobStore) *BroadcastScheduler {
+	return &BroadcastScheduler{
+		client:       client,
+		store:        store,
+		MaxRunsKept:  50,
+		PollInterval: time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// ScheduleCron schedules a recurring broadcast using a standard five field cron expression, evaluated in UTC
+func (s *BroadcastScheduler) ScheduleCron(ctx context.Context, input *BroadcastInput, spec string) (*ScheduledBroadcast, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+
+	now := time.Now().UTC()
+
+	return s.add(ctx, &ScheduledBroadcast{
+		ID:        uuid.NewV4().String(),
+		Input:     *input,
+		Cron:      spec,
+		NextRun:   schedule.Next(now),
+		CreatedAt: now,
+		Runs:      []BroadcastRun{},
+	})
+}
+
+// ScheduleAt schedules a broadcast to be sent once at the given time
+func (s *BroadcastScheduler) ScheduleAt(ctx context.Context, input *BroadcastInput, at time.Time) (*ScheduledBroadcast, error) {
+	at = at.UTC()
+
+	return s.add(ctx, &ScheduledBroadcast{
+		ID:        uuid.NewV4().String(),
+		Input:     *input,
+		At:        &at,
+		NextRun:   at,
+		CreatedAt: time.Now().UTC(),
+		Runs:      []BroadcastRun{},
+	})
+}
+
+func (s *BroadcastScheduler) add(ctx context.Context, job *ScheduledBroadcast) (*ScheduledBroadcast, error) {
+	if err := s.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+
+	return job, nil
+}
+
+// Cancel removes a scheduled broadcast along with its run history
+func (s *BroadcastScheduler) Cancel(ctx context.Context, id string) error {
+	if err := s.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Jobs lists the scheduled broadcasts ordered by their next run
+func (s *BroadcastScheduler) Jobs(ctx context.Context) ([]*ScheduledBroadcast, error) {
+	jobs, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].NextRun.Before(jobs[b].NextRun)
+	})
+
+	return jobs, nil
+}
+
+func (s *BroadcastScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends broadcasts as they become due until ctx is done
+// Store errors do not stop it, they are passed to OnError and the store is read again on the next poll
+func (s *BroadcastScheduler) Run(ctx context.Context) error {
+	for {
+		next := s.runDue(ctx)
+
+		wait := s.PollInterval
+		if wait <= 0 {
+			wait = time.Minute
+		}
+
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// runDue sends every due broadcast and returns when the next one is due
+func (s *BroadcastScheduler) runDue(ctx context.Context) time.Time {
+	jobs, err := s.store.List(ctx)
+	if err != nil {
+		s.reportError(fmt.Errorf("listing scheduled broadcasts: %w", err))
+		return time.Time{}
+	}
+
+	var next time.Time
+
+	for _, job := range jobs {
+		if job.Done() {
+			continue
+		}
+
+		if !job.NextRun.After(time.Now()) {
+			if err := s.runJob(ctx, job); err != nil && ctx.Err() == nil {
+				s.reportError(fmt.Errorf("running scheduled broadcast %s: %w", job.ID, err))
+			}
+		}
+
+		if !job.Done() && (next.IsZero() || job.NextRun.Before(next)) {
+			next = job.NextRun
+		}
+	}
+
+	return next
+}
+
+func (s *BroadcastScheduler) reportError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// runJob sends a due broadcast
+// The next run is persisted before sending, so a crash mid send never causes the broadcast to be sent twice
+func (s *BroadcastScheduler) runJob(ctx context.Context, job *ScheduledBroadcast) error {
+	now := time.Now().UTC()
+
+	run := BroadcastRun{
+		ScheduledAt: job.NextRun,
+		StartedAt:   now,
+	}
+
+	if job.Cron != "" {
+		schedule, err := cron.ParseStandard(job.Cron)
+		if err != nil {
+			run.Error = fmt.Sprintf("invalid cron expression: %s", err.Error())
+			job.NextRun = time.Time{}
+			return s.record(ctx, job, run)
+		}
+
+		job.NextRun = schedule.Next(now)
+	} else {
+		job.NextRun = time.Time{}
+	}
+
+	// The job may have been canceled since it was listed, saving it would bring it back
+	current, err := s.load(ctx, job.ID)
+	if err != nil || current == nil {
+		return err
+	}
+
+	current.NextRun = job.NextRun
+	if err := s.store.Save(ctx, current); err != nil {
+		return err
+	}
+
+	// Each run is a separate broadcast, so it must not be deduplicated against the previous one
+	runCtx := deriveIdempotencyKey(ctx, fmt.Sprintf("%s-run-%s", job.ID, run.ScheduledAt.Format(time.RFC3339)))
+
+	res, err := s.client.BroadcastWithContext(runCtx, &job.Input)
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		run.Result = res
+	}
+
+	return s.record(ctx, job, run)
+}
+
+// record adds a run to the stored job, the run is dropped when the job was canceled while it was being sent
+func (s *BroadcastScheduler) record(ctx context.Context, job *ScheduledBroadcast, run BroadcastRun) error {
+	current, err := s.load(ctx, job.ID)
+	if err != nil || current == nil {
+		return err
+	}
+
+	current.NextRun = job.NextRun
+	current.Runs = append(current.Runs, run)
+
+	if s.MaxRunsKept > 0 && len(current.Runs) > s.MaxRunsKept {
+		current.Runs = current.Runs[len(current.Runs)-s.MaxRunsKept:]
+	}
+
+	return s.store.Save(ctx, current)
+}
+
+// load reads a job from the store again, it returns nil when the job no longer exists
+func (s *BroadcastScheduler) load(ctx context.Context, id string) (*ScheduledBroadcast, error) {
+	job, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil, nil
+	}
+
+	return job, err
+}
+
+// FileJobStore keeps scheduled broadcasts in a JSON file
+// It is safe for concurrent use within a process, but not across processes
+type FileJobStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileJobStore creates a store backed by the file at path, which is created when the first job is saved
+func NewFileJobStore(path string) *FileJobStore {
+	return &FileJobStore{path: path}
+}
+
+func (f *FileJobStore) List(ctx context.Context) ([]*ScheduledBroadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*ScheduledBroadcast, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job)
+	}
+
+	return list, nil
+}
+
+func (f *FileJobStore) Get(ctx context.Context, id string) (*ScheduledBroadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	job, ok := jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+func (f *FileJobStore) Save(ctx context.Context, job *ScheduledBroadcast) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	jobs[job.ID] = job
+
+	return f.write(jobs)
+}
+
+func (f *FileJobStore) Delete(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+
+	delete(jobs, id)
+
+	return f.write(jobs)
+}
+
+func (f *FileJobStore) read() (map[string]*ScheduledBroadcast, error) {
+	jobs := make(map[string]*ScheduledBroadcast)
+
+	data, err := ioutil.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jobs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.path, err)
+	}
+
+	return jobs, nil
+}
+
+// write replaces the file atomically, so a crash never leaves a half written store behind
+func (f *FileJobStore) write(jobs map[string]*ScheduledBroadcast) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,277 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+// broadcastServer accepts every broadcast and counts them
+func broadcastServer() (*httptest.Server, *int32) {
+	var sent int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/executions/broadcast" {
+			atomic.AddInt32(&sent, 1)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"sent","users":1}`))
+	}))
+
+	return srv, &sent
+}
+
+func TestSchedulerSendsDueBroadcast(t *testing.T) {
+	srv, sent := broadcastServer()
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store := convai.NewFileJobStore(filepath.Join(dir, "jobs.json"))
+	sched := convai.NewBroadcastScheduler(convai.NewClient("key", convai.WithBaseURL(srv.URL)), store)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	job, err := sched.ScheduleAt(ctx, &convai.BroadcastInput{BroadcastType: "hi", Channel: "sms"}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(ctx) }()
+
+	for atomic.LoadInt32(sent) == 0 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Give the scheduler time to record the run
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if n := atomic.LoadInt32(sent); n != 1 {
+		t.Fatalf("expected the broadcast to be sent once, got %d", n)
+	}
+
+	// A new store over the same file sees the recorded run
+	jobs, err := convai.NewFileJobStore(filepath.Join(dir, "jobs.json")).List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != job.ID || !jobs[0].Done() {
+		t.Fatalf("expected the job to be done, got %+v", jobs)
+	}
+
+	if len(jobs[0].Runs) != 1 || jobs[0].Runs[0].Result == nil || jobs[0].Runs[0].Result.Users != 1 {
+		t.Fatalf("expected the run to be recorded, got %+v", jobs[0].Runs)
+	}
+}
+
+func TestSchedulerRejectsInvalidCron(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	sched := convai.NewBroadcastScheduler(convai.NewClient("key"), convai.NewFileJobStore(filepath.Join(dir, "jobs.json")))
+
+	if _, err := sched.ScheduleCron(context.Background(), &convai.BroadcastInput{}, "every day"); err == nil {
+		t.Fatal("expected an invalid cron expression to be rejected")
+	}
+
+	job, err := sched.ScheduleCron(context.Background(), &convai.BroadcastInput{}, "0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Done() || job.NextRun.Hour() != 9 || !job.NextRun.After(time.Now()) {
+		t.Fatalf("expected the next run at 9:00, got %s", job.NextRun)
+	}
+}
+
+// flakyStore fails the first List calls and counts them all
+type flakyStore struct {
+	convai.JobStore
+
+	mu        sync.Mutex
+	listFails int
+	lists     int
+}
+
+func (f *flakyStore) List(ctx context.Context) ([]*convai.ScheduledBroadcast, error) {
+	f.mu.Lock()
+	f.lists++
+	fail := f.listFails > 0
+	if fail {
+		f.listFails--
+	}
+	f.mu.Unlock()
+
+	if fail {
+		return nil, errors.New("store unavailable")
+	}
+
+	return f.JobStore.List(ctx)
+}
+
+func TestSchedulerKeepsRunningAfterStoreError(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store := &flakyStore{JobStore: convai.NewFileJobStore(filepath.Join(dir, "jobs.json")), listFails: 1}
+
+	var errs []error
+	sched := convai.NewBroadcastScheduler(srv.Client(), store)
+	sched.PollInterval = 10 * time.Millisecond
+	sched.OnError = func(err error) { errs = append(errs, err) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	job, err := sched.ScheduleAt(ctx, &convai.BroadcastInput{BroadcastType: "hi", Channel: "sms"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(ctx) }()
+
+	for len(srv.Broadcasts()) == 0 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if len(srv.Broadcasts()) != 1 {
+		t.Fatalf("expected the broadcast to be sent after the store recovered, got %d", len(srv.Broadcasts()))
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("expected the store error to be reported once, got %v", errs)
+	}
+
+	jobs, err := sched.Jobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != job.ID || !jobs[0].Done() {
+		t.Fatalf("expected the job to be done, got %+v", jobs)
+	}
+}
+
+func TestSchedulerDropsRunOfCanceledJob(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	sched := convai.NewBroadcastScheduler(srv.Client(), convai.NewFileJobStore(filepath.Join(dir, "jobs.json")))
+	sched.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	job, err := sched.ScheduleAt(ctx, &convai.BroadcastInput{BroadcastType: "hi", Channel: "sms"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel the job while its broadcast is in flight
+	canceled := make(chan error, 1)
+	srv.SetFailureHook(func(r *http.Request) (int, bool) {
+		if r.URL.Path == "/executions/broadcast" {
+			canceled <- sched.Cancel(context.Background(), job.ID)
+		}
+		return 0, false
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(ctx) }()
+
+	select {
+	case err := <-canceled:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the broadcast was never sent")
+	}
+
+	// Give the scheduler time to record the run
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	jobs, err := sched.Jobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 0 {
+		t.Fatalf("expected the canceled job to stay gone, got %+v", jobs)
+	}
+}
+
+func TestSchedulerListsOncePerPoll(t *testing.T) {
+	srv, sent := broadcastServer()
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store := &flakyStore{JobStore: convai.NewFileJobStore(filepath.Join(dir, "jobs.json"))}
+
+	// A zero poll interval falls back to a minute instead of polling in a loop
+	sched := convai.NewBroadcastScheduler(convai.NewClient("key", convai.WithBaseURL(srv.URL)), store)
+	sched.PollInterval = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := sched.ScheduleAt(ctx, &convai.BroadcastInput{BroadcastType: "hi", Channel: "sms"}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(ctx) }()
+
+	for atomic.LoadInt32(sent) < 3 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Once on start and once for the wake up left by scheduling, but not once per job
+	if store.lists > 2 {
+		t.Fatalf("expected the store to be listed at most twice, got %d", store.lists)
+	}
+}
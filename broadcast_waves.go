@@ -0,0 +1,329 @@
+package convai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// WaveByOffset sends consecutive pages of the audience, WaveSize users at a time
+	WaveByOffset = iota
+
+	// WaveByHash spreads the audience over a fixed number of waves based on a hash of the user ID,
+	// so the same user always lands in the same wave. A query with checks must use the all mode, so that
+	// each wave can add a check on the user IDs
+	WaveByHash
+)
+
+// WaveOptions configures a wave broadcast
+type WaveOptions struct {
+	Strategy int
+
+	// WaveSize is the number of users per wave for WaveByOffset, defaults to 100
+	WaveSize int
+
+	// Waves is the number of waves for WaveByHash, defaults to 10
+	Waves int
+
+	// Delay is the pause between two waves
+	Delay time.Duration
+
+	// OnWave is called after every wave
+	OnWave func(result WaveResult)
+}
+
+// WaveResult is the outcome of a single wave
+type WaveResult struct {
+	Wave      int              `json:"wave"`
+	StartedAt time.Time        `json:"startedAt"`
+	Result    *BroadcastResult `json:"result,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// WaveBroadcastResult aggregates the results of all waves
+type WaveBroadcastResult struct {
+	Waves []WaveResult `json:"waves"`
+
+	// Users is the sum of the users reported by each successful wave
+	Users    int  `json:"users"`
+	Failed   int  `json:"failed"`
+	Canceled bool `json:"canceled"`
+}
+
+// WaveBroadcast is a broadcast being delivered in waves, it can be paused, resumed and canceled
+type WaveBroadcast struct {
+	client *Client
+	input  BroadcastInput
+	opts   WaveOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	result  WaveBroadcastResult
+	err     error
+}
+
+// StartWaveBroadcast starts delivering a broadcast in waves in the background
+// Each wave is sent with Broadcast using a narrowed copy of the input's UserQuery
+func (c *Client) StartWaveBroadcast(ctx context.Context, input *BroadcastInput, opts WaveOptions) *WaveBroadcast {
+	if opts.WaveSize <= 0 {
+		opts.WaveSize = 100
+	}
+
+	if opts.Waves <= 0 {
+		opts.Waves = 10
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := &WaveBroadcast{
+		client: c,
+		input:  *input,
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		result: WaveBroadcastResult{Waves: []WaveResult{}},
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Pause stops the broadcast before its next wave, a wave that is being sent is completed
+func (w *WaveBroadcast) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.paused {
+		w.paused = true
+		w.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues a paused broadcast
+func (w *WaveBroadcast) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.paused {
+		w.paused = false
+		close(w.resumed)
+	}
+}
+
+// Cancel stops the broadcast, waves that were already sent are not undone
+func (w *WaveBroadcast) Cancel() {
+	w.cancel()
+}
+
+// Paused reports whether the broadcast is paused
+func (w *WaveBroadcast) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.paused
+}
+
+// Progress returns the results of the waves sent so far
+func (w *WaveBroadcast) Progress() WaveBroadcastResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := w.result
+	res.Waves = append([]WaveResult{}, w.result.Waves...)
+
+	return res
+}
+
+// Wait blocks until every wave was sent or the broadcast was canceled
+// The error is only set when the audience could not be determined, failed waves are reported in the result
+func (w *WaveBroadcast) Wait() (*WaveBroadcastResult, error) {
+	<-w.done
+
+	res := w.Progress()
+	return &res, w.err
+}
+
+func (w *WaveBroadcast) run() {
+	defer close(w.done)
+	defer w.cancel()
+
+	var err error
+	if w.opts.Strategy == WaveByHash {
+		err = w.runByHash()
+	} else {
+		err = w.runByOffset()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ctx.Err() != nil {
+		w.result.Canceled = true
+	} else {
+		w.err = err
+	}
+}
+
+// runByOffset sends consecutive windows of the audience, covering the input's Limit users from its Offset
+// A limit of 0 covers every user from the offset on
+func (w *WaveBroadcast) runByOffset() error {
+	base, total := w.input.UserQuery.Offset, w.input.UserQuery.Limit
+
+	for wave, covered := 0, 0; total <= 0 || covered < total; wave++ {
+		size := w.opts.WaveSize
+		if total > 0 && total-covered < size {
+			size = total - covered
+		}
+
+		query := w.input.UserQuery
+		query.Offset = base + covered
+		query.Limit = size
+
+		// Check the page is not empty first, broadcasting to an empty page would not tell us we are done
+		// A short page is not the end, the API may cap the page size below the wave size
+		page, err := w.client.QueryUsersWithContext(w.ctx, &query)
+		if err != nil {
+			return err
+		}
+
+		if len(page.Users) == 0 {
+			return nil
+		}
+
+		if !w.send(wave, query) {
+			return nil
+		}
+
+		covered += size
+	}
+
+	return nil
+}
+
+// runByHash buckets the users within the input's Offset and Limit, then sends each bucket by narrowing a copy
+// of the input query to the IDs in the bucket
+func (w *WaveBroadcast) runByHash() error {
+	if len(w.input.UserQuery.Checks) > 0 && w.input.UserQuery.Mode != UQMAll {
+		return fmt.Errorf("waves by hash need a query in all mode to narrow, got mode %d", w.input.UserQuery.Mode)
+	}
+
+	buckets := make([][]string, w.opts.Waves)
+
+	query := w.input.UserQuery
+
+	it := w.client.IterateUsers(w.ctx, &query)
+	defer it.Close()
+
+	for n := 0; (query.Limit <= 0 || n < query.Limit) && it.Next(); n++ {
+		user := it.User()
+
+		h := fnv.New32a()
+		h.Write([]byte(user.ID.String()))
+		bucket := h.Sum32() % uint32(w.opts.Waves)
+
+		// A channel search matches on channel user IDs instead of super user IDs
+		if query.ChannelSearch {
+			for _, cu := range user.ChannelUsers {
+				buckets[bucket] = append(buckets[bucket], cu.ChannelId)
+			}
+		} else {
+			buckets[bucket] = append(buckets[bucket], user.ID.String())
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	for wave, ids := range buckets {
+		if len(ids) == 0 {
+			continue
+		}
+
+		q := w.input.UserQuery
+		q.Mode = UQMAll
+		q.Checks = append(append([]QueryCheck{}, q.Checks...), QueryCheck{Field: "id", Operation: UQEquals, Values: ids})
+		q.Offset = 0
+		q.Limit = len(ids)
+
+		if !w.send(wave, q) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// send waits for the delay and any pause, then sends one wave. It returns false once the broadcast was canceled
+func (w *WaveBroadcast) send(wave int, query UserQuery) bool {
+	w.mu.Lock()
+	first := len(w.result.Waves) == 0
+	w.mu.Unlock()
+
+	if !first && w.opts.Delay > 0 {
+		if sleep(w.ctx, w.opts.Delay) != nil {
+			return false
+		}
+	}
+
+	if !w.waitIfPaused() {
+		return false
+	}
+
+	input := w.input
+	input.UserQuery = query
+
+	res := WaveResult{Wave: wave, StartedAt: time.Now().UTC()}
+
+	// Give each wave its own key, so restarting a broadcast with the same key only sends the waves that are missing
+	ctx := deriveIdempotencyKey(w.ctx, fmt.Sprintf("wave-%d", wave))
+
+	broadcast, err := w.client.BroadcastWithContext(ctx, &input)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Result = broadcast
+	}
+
+	w.mu.Lock()
+	w.result.Waves = append(w.result.Waves, res)
+	if err != nil {
+		w.result.Failed++
+	} else {
+		w.result.Users += broadcast.Users
+	}
+	w.mu.Unlock()
+
+	if w.opts.OnWave != nil {
+		w.opts.OnWave(res)
+	}
+
+	return w.ctx.Err() == nil
+}
+
+func (w *WaveBroadcast) waitIfPaused() bool {
+	w.mu.Lock()
+	paused, resumed := w.paused, w.resumed
+	w.mu.Unlock()
+
+	if !paused {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,320 @@
+package convai_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+	uuid "github.com/satori/go.uuid"
+)
+
+// audienceServer serves n users by offset and limit, and counts how often each user is broadcast to
+type audienceServer struct {
+	*httptest.Server
+
+	users []convai.SuperUser
+
+	mu      sync.Mutex
+	reached map[uuid.UUID]int
+}
+
+func newAudienceServer(n int) *audienceServer {
+	s := &audienceServer{users: make([]convai.SuperUser, n), reached: make(map[uuid.UUID]int)}
+	for i := range s.users {
+		s.users[i] = convai.SuperUser{ID: uuid.NewV4()}
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query convai.UserQuery
+
+		switch r.URL.Path {
+		case "/users/super/query":
+			json.NewDecoder(r.Body).Decode(&query)
+		case "/executions/broadcast":
+			var input convai.BroadcastInput
+			json.NewDecoder(r.Body).Decode(&input)
+			query = input.UserQuery
+		}
+
+		page := s.page(query)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/executions/broadcast" {
+			s.mu.Lock()
+			for _, u := range page {
+				s.reached[u.ID]++
+			}
+			s.mu.Unlock()
+
+			json.NewEncoder(w).Encode(convai.BroadcastResult{Status: "sent", Users: len(page)})
+			return
+		}
+
+		json.NewEncoder(w).Encode(convai.UserQueryResult{Users: page, Count: uint64(len(s.users))})
+	}))
+
+	return s
+}
+
+func (s *audienceServer) page(query convai.UserQuery) []convai.SuperUser {
+	if query.Offset >= len(s.users) {
+		return []convai.SuperUser{}
+	}
+
+	end := len(s.users)
+	if query.Limit > 0 && query.Offset+query.Limit < end {
+		end = query.Offset + query.Limit
+	}
+
+	return s.users[query.Offset:end]
+}
+
+func (s *audienceServer) sent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, count := range s.reached {
+		n += count
+	}
+
+	return n
+}
+
+func TestWaveBroadcastByOffsetReachesEveryUserOnce(t *testing.T) {
+	srv := newAudienceServer(5)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	w := client.StartWaveBroadcast(context.Background(), &convai.BroadcastInput{Channel: "sms"}, convai.WaveOptions{WaveSize: 2})
+
+	res, err := w.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Waves) != 3 || res.Users != 5 || res.Failed != 0 {
+		t.Fatalf("expected 3 waves reaching 5 users, got %+v", res)
+	}
+
+	for _, u := range srv.users {
+		if n := srv.reached[u.ID]; n != 1 {
+			t.Fatalf("expected %s to be reached once, got %d", u.ID, n)
+		}
+	}
+}
+
+func TestWaveBroadcastByOffsetHonorsLimit(t *testing.T) {
+	srv := newAudienceServer(6)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	input := &convai.BroadcastInput{Channel: "sms", UserQuery: convai.UserQuery{Offset: 1, Limit: 3}}
+
+	res, err := client.StartWaveBroadcast(context.Background(), input, convai.WaveOptions{WaveSize: 2}).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Waves) != 2 || res.Users != 3 {
+		t.Fatalf("expected 2 waves reaching 3 users, got %+v", res)
+	}
+
+	for i, u := range srv.users {
+		want := 0
+		if i >= 1 && i <= 3 {
+			want = 1
+		}
+
+		if n := srv.reached[u.ID]; n != want {
+			t.Fatalf("expected user %d to be reached %d times, got %d", i, want, n)
+		}
+	}
+}
+
+// newAudience creates a fake with n users that each have one sms channel user, cu0 to cu<n-1>,
+// and one user that is only on the web channel
+func newAudience(n int) *convaitest.Server {
+	srv := convaitest.NewServer()
+
+	for i := 0; i < n; i++ {
+		srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: fmt.Sprintf("cu%d", i), Channel: "sms"}}})
+	}
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "web", Channel: "web"}}})
+
+	return srv
+}
+
+func TestWaveBroadcastByHashKeepsQuery(t *testing.T) {
+	srv := newAudience(5)
+	defer srv.Close()
+
+	input := &convai.BroadcastInput{Channel: "sms", UserQuery: convai.UserQuery{
+		Mode:          convai.UQMAll,
+		ChannelSearch: true,
+		Checks:        []convai.QueryCheck{{Field: "channel", Operation: convai.UQEquals, Values: []string{"sms"}}},
+	}}
+
+	res, err := srv.Client().StartWaveBroadcast(context.Background(), input, convai.WaveOptions{Strategy: convai.WaveByHash, Waves: 3}).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Users != 5 || res.Failed != 0 {
+		t.Fatalf("expected the waves to reach 5 users, got %+v", res)
+	}
+
+	reached := map[string]int{}
+	for _, e := range srv.Executions() {
+		reached[e.ChannelUserID]++
+	}
+
+	if len(reached) != 5 || reached["web"] != 0 {
+		t.Fatalf("expected the 5 sms users to be reached, got %v", reached)
+	}
+
+	for id, n := range reached {
+		if n != 1 {
+			t.Fatalf("expected %s to be reached once, got %d", id, n)
+		}
+	}
+
+	for _, b := range srv.Broadcasts() {
+		if !b.UserQuery.ChannelSearch || len(b.UserQuery.Checks) != 2 {
+			t.Fatalf("expected every wave to narrow the channel search, got %+v", b.UserQuery)
+		}
+	}
+}
+
+func TestWaveBroadcastByHashHonorsLimit(t *testing.T) {
+	srv := newAudience(5)
+	defer srv.Close()
+
+	input := &convai.BroadcastInput{Channel: "sms", UserQuery: convai.UserQuery{Mode: convai.UQMAll, Offset: 1, Limit: 2}}
+
+	res, err := srv.Client().StartWaveBroadcast(context.Background(), input, convai.WaveOptions{Strategy: convai.WaveByHash, Waves: 3}).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Users != 2 {
+		t.Fatalf("expected the waves to reach 2 users, got %+v", res)
+	}
+
+	reached := map[string]bool{}
+	for _, e := range srv.Executions() {
+		reached[e.ChannelUserID] = true
+	}
+
+	if len(reached) != 2 || !reached["cu1"] || !reached["cu2"] {
+		t.Fatalf("expected cu1 and cu2 to be reached, got %v", reached)
+	}
+}
+
+func TestWaveBroadcastByHashNeedsAllMode(t *testing.T) {
+	srv := newAudience(1)
+	defer srv.Close()
+
+	input := &convai.BroadcastInput{Channel: "sms", UserQuery: *convai.UserQueryBuilder().Any().Where("id").Exists().Build()}
+
+	if _, err := srv.Client().StartWaveBroadcast(context.Background(), input, convai.WaveOptions{Strategy: convai.WaveByHash}).Wait(); err == nil {
+		t.Fatal("expected a query in any mode to be refused")
+	}
+
+	if len(srv.Broadcasts()) != 0 {
+		t.Fatal("expected nothing to be sent")
+	}
+}
+
+func TestWaveBroadcastPauseResume(t *testing.T) {
+	srv := newAudienceServer(5)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	var w *convai.WaveBroadcast
+	// OnWave waits for started so that it never sees w before it is assigned
+	started := make(chan struct{})
+	waves := make(chan int, 3)
+
+	w = client.StartWaveBroadcast(context.Background(), &convai.BroadcastInput{Channel: "sms"}, convai.WaveOptions{
+		WaveSize: 2,
+		OnWave: func(result convai.WaveResult) {
+			<-started
+			if result.Wave == 0 {
+				w.Pause()
+			}
+			waves <- result.Wave
+		},
+	})
+	close(started)
+
+	<-waves
+
+	// The broadcast must not move past the first wave while paused
+	time.Sleep(50 * time.Millisecond)
+	if n := len(w.Progress().Waves); n != 1 || !w.Paused() {
+		t.Fatalf("expected the broadcast to be paused after 1 wave, got %d waves", n)
+	}
+
+	w.Resume()
+
+	res, err := w.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Waves) != 3 || res.Users != 5 || res.Canceled {
+		t.Fatalf("expected all 3 waves after resuming, got %+v", res)
+	}
+}
+
+func TestWaveBroadcastCancel(t *testing.T) {
+	srv := newAudienceServer(5)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	var w *convai.WaveBroadcast
+	// OnWave waits for started so that it never sees w before it is assigned
+	started := make(chan struct{})
+
+	w = client.StartWaveBroadcast(context.Background(), &convai.BroadcastInput{Channel: "sms"}, convai.WaveOptions{
+		WaveSize: 2,
+		OnWave: func(result convai.WaveResult) {
+			<-started
+			w.Pause()
+		},
+	})
+	close(started)
+
+	for len(w.Progress().Waves) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w.Cancel()
+
+	res, err := w.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Canceled || len(res.Waves) != 1 {
+		t.Fatalf("expected the broadcast to stop after 1 wave, got %+v", res)
+	}
+
+	if n := srv.sent(); n != 2 {
+		t.Fatalf("expected 2 users to be reached before canceling, got %d", n)
+	}
+}
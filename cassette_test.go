@@ -0,0 +1,143 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+// replayQuery records a user query against a fake holding one user with a phone number,
+// then replays it from the cassette file after the fake is gone
+func replayQuery(t *testing.T, path string, opts ...convai.Option) *convai.UserQueryResult {
+	srv := convaitest.NewServer()
+	srv.AddUser(convai.SuperUser{Data: map[string]interface{}{"phone": "15551234", "name": "Ada"}})
+
+	rec, err := convaitest.NewCassette(path, convaitest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.RedactFields = []string{"phone"}
+
+	recorded, err := srv.Client(append(opts, convai.WithHTTPClient(rec.HTTPClient()))...).QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded.Users[0].Data["phone"] != "15551234" {
+		t.Fatalf("expected the recording client to see the real response, got %v", recorded.Users[0].Data)
+	}
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+
+	replay, err := convaitest.NewCassette(path, convaitest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.RedactFields = rec.RedactFields
+
+	res, err := srv.Client(append(opts, convai.WithHTTPClient(replay.HTTPClient()))...).QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replay.Unused()) != 0 {
+		t.Fatalf("expected every interaction to be replayed, got %+v", replay.Unused())
+	}
+
+	return res
+}
+
+func TestCassetteRecordsAndReplays(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassette.json")
+
+	res := replayQuery(t, path)
+
+	if len(res.Users) != 1 || res.Users[0].Data["name"] != "Ada" || res.Users[0].Data["phone"] != convaitest.Redacted {
+		t.Fatalf("expected the recorded user with a redacted phone, got %+v", res.Users)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "15551234") || strings.Contains(string(data), convaitest.DefaultAPIKey) {
+		t.Fatalf("expected the phone and the API key to be left out of the cassette, got %s", data)
+	}
+}
+
+func TestCassetteRedactsMsgpackBodies(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	res := replayQuery(t, filepath.Join(dir, "cassette.json"), convai.WithCodec(convai.MsgpackCodec))
+
+	if len(res.Users) != 1 || res.Users[0].Data["name"] != "Ada" || res.Users[0].Data["phone"] != convaitest.Redacted {
+		t.Fatalf("expected the recorded user with a redacted phone, got %+v", res.Users)
+	}
+}
+
+func TestCassetteRefusesBodiesItCannotRedact(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("phone=15551234"))
+	}))
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	rec, err := convaitest.NewCassette(filepath.Join(dir, "cassette.json"), convaitest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.RedactFields = []string{"phone"}
+
+	if _, err := rec.HTTPClient().Get(srv.URL); err == nil {
+		t.Fatal("expected a body that cannot be redacted to fail the recording")
+	}
+
+	if len(rec.Interactions()) != 0 {
+		t.Fatalf("expected nothing to be recorded, got %+v", rec.Interactions())
+	}
+}
+
+func TestCassetteDoesNotRetryUnmatchedRequests(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassette.json")
+	if err := ioutil.WriteFile(path, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := convaitest.NewCassette(path, convaitest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := convai.NewClient("key", convai.WithHTTPClient(replay.HTTPClient()), convai.WithRetryPolicy(fastRetries))
+
+	_, err = client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+
+	var retryErr *convai.RetryError
+	if !errors.Is(err, convaitest.ErrNoInteraction) || errors.As(err, &retryErr) {
+		t.Fatalf("expected ErrNoInteraction after a single attempt, got %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package convai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen matches the error returned when a circuit breaker refuses a call
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of an endpoint's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails every call straight away
+	BreakerOpen
+
+	// BreakerHalfOpen lets a few probe calls through to find out whether the endpoint recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// CircuitBreaker configures the circuit breakers of a client, each endpoint has its own breaker
+// Transport errors, including timeouts, and 5xx responses count as failures. Other errors mean the API answered,
+// and calls the caller canceled are not counted at all
+type CircuitBreaker struct {
+	// Window is the period failures are counted over, defaults to a minute
+	Window time.Duration
+
+	// MinRequests is the number of calls needed in a window before the breaker can open, defaults to 10
+	MinRequests int
+
+	// FailureRatio opens the breaker once this share of the calls in a window failed, defaults to 0.5
+	FailureRatio float64
+
+	// OpenDuration is how long the breaker stays open before probing the endpoint, defaults to 30 seconds
+	OpenDuration time.Duration
+
+	// HalfOpenProbes is the number of probe calls let through while half open, all of them must succeed
+	// for the breaker to close. Defaults to 1
+	HalfOpenProbes int
+
+	// OnStateChange is called whenever an endpoint's breaker changes state
+	OnStateChange func(endpoint string, from, to BreakerState)
+}
+
+// WithCircuitBreaker makes calls to an endpoint that keeps failing fail fast with ErrCircuitOpen
+func WithCircuitBreaker(config CircuitBreaker) Option {
+	return func(o *clientOptions) {
+		o.circuitBreaker = &config
+	}
+}
+
+// CircuitOpenError is returned instead of making a call while the endpoint's breaker is open
+type CircuitOpenError struct {
+	Endpoint string
+
+	// Until is when the breaker lets probe calls through again
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s until %s", e.Endpoint, ErrCircuitOpen.Error(), e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState returns the state of an endpoint's breaker, e.g. CircuitState("Trigger")
+// Endpoints are named after the Client method, endpoints that were not called yet and clients without a
+// circuit breaker report BreakerClosed. Looking a state up never creates a breaker
+func (c *Client) CircuitState(endpoint string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+
+	c.breakers.mu.Lock()
+	b, ok := c.breakers.breakers[endpoint]
+	c.breakers.mu.Unlock()
+
+	if !ok {
+		return BreakerClosed
+	}
+
+	return b.currentState()
+}
+
+// BreakerStates returns the state of the breaker of every endpoint called so far, for use in health checks
+func (c *Client) BreakerStates() map[string]BreakerState {
+	states := make(map[string]BreakerState)
+	if c.breakers == nil {
+		return states
+	}
+
+	c.breakers.mu.Lock()
+	breakers := make([]*breaker, 0, len(c.breakers.breakers))
+	for _, b := range c.breakers.breakers {
+		breakers = append(breakers, b)
+	}
+	c.breakers.mu.Unlock()
+
+	for _, b := range breakers {
+		states[b.endpoint] = b.currentState()
+	}
+
+	return states
+}
+
+type breakerSet struct {
+	config CircuitBreaker
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerSet(config CircuitBreaker) *breakerSet {
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = 0.5
+	}
+
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+
+	return &breakerSet{
+		config:   config,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+func (s *breakerSet) get(endpoint string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[endpoint]
+	if !ok {
+		b = &breaker{
+			endpoint:    endpoint,
+			config:      &s.config,
+			windowStart: time.Now(),
+		}
+		s.breakers[endpoint] = b
+	}
+
+	return b
+}
+
+type breaker struct {
+	endpoint string
+	config   *CircuitBreaker
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// currentState moves an open breaker to half open once its open duration passed
+func (b *breaker) currentState() BreakerState {
+	b.mu.Lock()
+	from := b.state
+	b.advance(time.Now())
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(from, state)
+
+	return state
+}
+
+// advance applies the transitions that only depend on time, the lock must be held
+func (b *breaker) advance(now time.Time) {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) >= b.config.OpenDuration {
+			b.setState(BreakerHalfOpen)
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+	}
+}
+
+// allow reserves a call, it returns the generation the outcome has to be recorded against
+func (b *breaker) allow() (int, error) {
+	b.mu.Lock()
+	from := b.state
+	generation, err := b.reserve(time.Now())
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(from, state)
+
+	return generation, err
+}
+
+func (b *breaker) reserve(now time.Time) (int, error) {
+	b.advance(now)
+
+	switch b.state {
+	case BreakerOpen:
+		return 0, &CircuitOpenError{Endpoint: b.endpoint, Until: b.openedAt.Add(b.config.OpenDuration)}
+	case BreakerHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return 0, &CircuitOpenError{Endpoint: b.endpoint, Until: now}
+		}
+
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// record counts the outcome of a call, outcomes from before the last state change are ignored
+// A call that is not counted, e.g. because the caller canceled it, only gives its probe back
+func (b *breaker) record(generation int, failed, counted bool) {
+	b.mu.Lock()
+	from := b.state
+	if generation == b.generation {
+		b.count(time.Now(), failed, counted)
+	}
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(from, state)
+}
+
+func (b *breaker) count(now time.Time, failed, counted bool) {
+	switch b.state {
+	case BreakerClosed:
+		if !counted {
+			return
+		}
+
+		b.advance(now)
+
+		b.requests++
+		if failed {
+			b.failures++
+		}
+
+		if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRatio {
+			b.openedAt = now
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if !counted {
+			b.probes--
+			return
+		}
+
+		if failed {
+			b.openedAt = now
+			b.setState(BreakerOpen)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenProbes {
+			b.windowStart = now
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// setState moves to a new state and resets its counters, the lock must be held
+func (b *breaker) setState(state BreakerState) {
+	b.state = state
+	b.generation++
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+}
+
+// notify calls OnStateChange outside the lock, so the callback may inspect the client's breakers
+func (b *breaker) notify(from, to BreakerState) {
+	if from != to && b.config.OnStateChange != nil {
+		b.config.OnStateChange(b.endpoint, from, to)
+	}
+}
+
+// breakerOutcome reports whether a call failed in a way that suggests the endpoint is unhealthy,
+// and whether the call should be counted at all
+func breakerOutcome(ctx context.Context, err error) (failed, counted bool) {
+	if err == nil {
+		return false, true
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, ErrRateLimitExceeded) {
+		return false, false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500, true
+	}
+
+	var transportErr *TransportError
+	return errors.As(err, &transportErr), true
+}
@@ -0,0 +1,139 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	var (
+		mu          sync.Mutex
+		transitions []string
+	)
+
+	client := srv.Client(convai.WithCircuitBreaker(convai.CircuitBreaker{
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		OpenDuration: 50 * time.Millisecond,
+		OnStateChange: func(endpoint string, from, to convai.BreakerState) {
+			mu.Lock()
+			transitions = append(transitions, endpoint+" "+from.String()+" "+to.String())
+			mu.Unlock()
+		},
+	}))
+
+	query := func() error {
+		_, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+		return err
+	}
+
+	srv.FailNext("POST", "/users/super/query", 503, 2)
+
+	for i := 0; i < 4; i++ {
+		query()
+	}
+
+	if state := client.CircuitState("QueryUsers"); state != convai.BreakerOpen {
+		t.Fatalf("expected the breaker to open after 2 of 4 calls failed, got %s", state)
+	}
+
+	sent := len(srv.Requests())
+
+	err := query()
+
+	var openErr *convai.CircuitOpenError
+	if !errors.Is(err, convai.ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Endpoint != "QueryUsers" {
+		t.Fatalf("expected a CircuitOpenError for QueryUsers, got %v", err)
+	}
+
+	if len(srv.Requests()) != sent {
+		t.Fatal("expected the open breaker to refuse the call without sending it")
+	}
+
+	// Other endpoints are not affected, and looking their state up does not create a breaker for them
+	if state := client.CircuitState("QueryExecutions"); state != convai.BreakerClosed {
+		t.Fatalf("expected other endpoints to stay closed, got %s", state)
+	}
+
+	if _, ok := client.BreakerStates()["QueryExecutions"]; ok {
+		t.Fatal("expected looking up a state not to create a breaker")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if state := client.CircuitState("QueryUsers"); state != convai.BreakerHalfOpen {
+		t.Fatalf("expected the breaker to be half open after its open duration, got %s", state)
+	}
+
+	if err := query(); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := client.CircuitState("QueryUsers"); state != convai.BreakerClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got %s", state)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"QueryUsers closed open", "QueryUsers open half-open", "QueryUsers half-open closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("expected transitions %v, got %v", want, transitions)
+	}
+
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("expected transitions %v, got %v", want, transitions)
+		}
+	}
+}
+
+func TestCircuitBreakerReopensOnFailedProbe(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	client := srv.Client(convai.WithCircuitBreaker(convai.CircuitBreaker{
+		MinRequests:  1,
+		OpenDuration: 20 * time.Millisecond,
+	}))
+
+	srv.FailNext("POST", "/users/super/query", 500, 2)
+
+	client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); errors.Is(err, convai.ErrCircuitOpen) || err == nil {
+		t.Fatalf("expected the probe to be sent and fail, got %v", err)
+	}
+
+	if state := client.CircuitState("QueryUsers"); state != convai.BreakerOpen {
+		t.Fatalf("expected a failed probe to open the breaker again, got %s", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	client := srv.Client(convai.WithCircuitBreaker(convai.CircuitBreaker{MinRequests: 2}))
+
+	srv.FailNext("POST", "/users/super/query", 400, 5)
+
+	for i := 0; i < 5; i++ {
+		client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+	}
+
+	if state := client.CircuitState("QueryUsers"); state != convai.BreakerClosed {
+		t.Fatalf("expected 4xx responses not to open the breaker, got %s", state)
+	}
+}
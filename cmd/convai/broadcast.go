@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func runBroadcast(client *convai.Client, args []string) error {
+	return subcommand("broadcast", client, args, map[string]func(*convai.Client, []string) error{
+		"reachable": broadcastReachable,
+		"send":      broadcastSend,
+	})
+}
+
+func broadcastReachable(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("broadcast reachable", flag.ExitOnError)
+	q := addUserQueryFlags(flags)
+	flags.Parse(args)
+
+	query, err := q.build()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.QueryUsersReachable(query)
+	if err != nil {
+		return err
+	}
+
+	return output(res, func() ([]string, [][]string) {
+		return []string{"REACHABLE"}, [][]string{{fmt.Sprint(res.Count)}}
+	})
+}
+
+func broadcastSend(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("broadcast send", flag.ExitOnError)
+	q := addUserQueryFlags(flags)
+	channel := flags.String("channel", "", "channel to broadcast on (required)")
+	broadcastType := flags.String("type", "", "broadcast type")
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	var set, setSession, setUser multiFlag
+	flags.Var(&set, "set", "context value to set as key=value or key:=json, repeatable")
+	flags.Var(&setSession, "set-session", "session value to set as key=value or key:=json, repeatable")
+	flags.Var(&setUser, "set-user", "user value to set as key=value or key:=json, repeatable")
+	flags.Parse(args)
+
+	if *channel == "" {
+		return fmt.Errorf("-channel is required")
+	}
+
+	query, err := q.build()
+	if err != nil {
+		return err
+	}
+
+	input := &convai.BroadcastInput{
+		BroadcastType: *broadcastType,
+		Channel:       *channel,
+		UserQuery:     *query,
+	}
+
+	if len(set)+len(setSession)+len(setUser) > 0 {
+		cm := convai.NewContextModifier()
+
+		for _, s := range []struct {
+			pairs []string
+			apply func(key string, value interface{}) *convai.ContextModifier
+		}{
+			{set, cm.Set},
+			{setSession, cm.SetSession},
+			{setUser, cm.SetUser},
+		} {
+			values, err := parseAssignments(s.pairs)
+			if err != nil {
+				return err
+			}
+
+			for key, value := range values {
+				s.apply(key, value)
+			}
+		}
+
+		input.ContextModifier = cm
+	}
+
+	if !*yes {
+		reachable, err := client.QueryUsersReachable(query)
+		if err != nil {
+			return err
+		}
+
+		if !confirm(fmt.Sprintf("send a broadcast to %d reachable users on %s?", reachable.Count, *channel)) {
+			return nil
+		}
+	}
+
+	res, err := client.Broadcast(input)
+	if err != nil {
+		return err
+	}
+
+	return output(res, func() ([]string, [][]string) {
+		return []string{"STATUS", "USERS"}, [][]string{{res.Status, fmt.Sprint(res.Users)}}
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+const chatHelp = `type a message and press enter to send it
+  <number>   pick a quick reply
+  /start     restart the conversation from the beginning
+  /session   show the session stack
+  /flags     show the context flags of the last turn
+  /quit      exit`
+
+func runChat(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	user := flags.String("user", "", "channel user ID to chat as (required)")
+	start := flags.Bool("start", false, "start the conversation from the beginning")
+	showSession := flags.Bool("show-session", false, "show the session stack after every turn")
+	showFlags := flags.Bool("show-flags", false, "show the context flags after every turn")
+	flags.Parse(args)
+
+	if *user == "" {
+		fmt.Fprintln(os.Stderr, "chat: -user is required")
+		flags.Usage()
+		return errUsage
+	}
+
+	c := &chat{
+		client:      client,
+		conv:        client.Converse(*user),
+		out:         os.Stdout,
+		showSession: *showSession,
+		showFlags:   *showFlags,
+	}
+
+	fmt.Fprintln(c.out, chatHelp)
+
+	if *start {
+		c.turn(c.conv.Start(context.Background()))
+	}
+
+	return c.loop(os.Stdin)
+}
+
+type chat struct {
+	client *convai.Client
+	conv   *convai.Conversation
+	out    io.Writer
+
+	showSession bool
+	showFlags   bool
+}
+
+func (c *chat) loop(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(c.out, "> ")
+
+		if !scanner.Scan() {
+			fmt.Fprintln(c.out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		ctx := context.Background()
+
+		switch line {
+		case "":
+			continue
+		case "/quit", "/exit":
+			return nil
+		case "/start":
+			c.turn(c.conv.Start(ctx))
+			continue
+		case "/session":
+			c.printSession(ctx)
+			continue
+		case "/flags":
+			c.printFlags()
+			continue
+		}
+
+		c.turn(c.conv.Say(ctx, c.resolveQuickReply(line)))
+	}
+}
+
+// resolveQuickReply turns the number of a quick reply into its value, anything else is sent as typed
+func (c *chat) resolveQuickReply(line string) string {
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return line
+	}
+
+	last := c.conv.Last()
+	if last == nil {
+		return line
+	}
+
+	qrs := last.QuickReplies()
+	if n < 1 || n > len(qrs) {
+		return line
+	}
+
+	if qrs[n-1].Value != nil {
+		return *qrs[n-1].Value
+	}
+
+	return qrs[n-1].Text
+}
+
+func (c *chat) turn(reply *convai.Reply, err error) {
+	if err != nil {
+		fmt.Fprintf(c.out, "! %s\n", err.Error())
+		return
+	}
+
+	for _, batch := range reply.Batches {
+		for _, m := range batch {
+			c.printMessage(m)
+		}
+	}
+
+	for _, e := range reply.Errors {
+		fmt.Fprintf(c.out, "! %s error: %s\n", e.ErrorType, e.Message)
+	}
+
+	if c.showSession {
+		c.printSession(context.Background())
+	}
+
+	if c.showFlags {
+		c.printFlags()
+	}
+}
+
+func (c *chat) printMessage(m convai.XMLMessage) {
+	prefix := "bot"
+	if m.Sender != nil && m.Sender.Name != "" {
+		prefix = m.Sender.Name
+	}
+
+	if m.Text != nil {
+		fmt.Fprintf(c.out, "%s: %s\n", prefix, *m.Text)
+	}
+
+	if m.Image != nil {
+		fmt.Fprintf(c.out, "%s: [image] %s\n", prefix, imageRef(m.Image))
+	}
+
+	if m.CardCollection != nil {
+		for _, card := range m.CardCollection.Cards {
+			title := card.Title
+			if card.Subtitle != nil {
+				title += " - " + *card.Subtitle
+			}
+
+			fmt.Fprintf(c.out, "  +-- %s\n", title)
+
+			if card.Image != nil {
+				fmt.Fprintf(c.out, "  |   [image] %s\n", imageRef(card.Image))
+			}
+
+			for _, b := range card.Buttons {
+				switch {
+				case b.URL != nil:
+					fmt.Fprintf(c.out, "  |   (%s) -> %s\n", b.Text, *b.URL)
+				case b.Value != nil:
+					fmt.Fprintf(c.out, "  |   (%s) = %s\n", b.Text, *b.Value)
+				default:
+					fmt.Fprintf(c.out, "  |   (%s)\n", b.Text)
+				}
+			}
+		}
+	}
+
+	for i, qr := range m.QuickReplies {
+		label := qr.Text
+		switch {
+		case qr.Phone:
+			label += " (phone)"
+		case qr.Email:
+			label += " (email)"
+		}
+
+		fmt.Fprintf(c.out, "  [%d] %s\n", i+1, label)
+	}
+}
+
+func imageRef(img *convai.XMLImage) string {
+	if img.URL != "" {
+		return img.URL
+	}
+
+	return img.ID
+}
+
+func (c *chat) printSession(ctx context.Context) {
+	session, err := c.client.GetSessionWithContext(ctx, c.conv.ChannelUserID())
+	if err != nil {
+		fmt.Fprintf(c.out, "! fetching session: %s\n", err.Error())
+		return
+	}
+
+	fmt.Fprintf(c.out, "session %s (version %s)\n", session.ID.String(), session.Version)
+	for i, frame := range session.Stack.Frames {
+		fmt.Fprintf(c.out, "  #%d module %d node %d", i, frame.Module, frame.Node)
+		if len(frame.Vars) > 0 {
+			vars, _ := json.Marshal(frame.Vars)
+			fmt.Fprintf(c.out, " vars %s", vars)
+		}
+		fmt.Fprintln(c.out)
+	}
+}
+
+func (c *chat) printFlags() {
+	last := c.conv.Last()
+	if last == nil {
+		fmt.Fprintln(c.out, "no turns yet")
+		return
+	}
+
+	sections := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"context", last.Execution.Data},
+		{"session", last.Execution.SessionData},
+		{"user", last.Execution.UserData},
+	}
+
+	for _, s := range sections {
+		data, _ := json.MarshalIndent(s.data, "  ", "  ")
+		fmt.Fprintf(c.out, "%s flags:\n  %s\n", s.name, data)
+	}
+}
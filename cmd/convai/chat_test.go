@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+// menuHandler offers two quick replies and echoes anything else it receives
+func menuHandler(req *convai.TriggerRequest, user *convai.ChannelUser, session *convai.Session) (*convai.Response, []convai.ExecError) {
+	if req.Text != "menu" {
+		return convaitest.EchoHandler(req, user, session)
+	}
+
+	text, value := "pick one", "pizza-42"
+
+	return &convai.Response{Messages: []convai.Message{{Message: convai.XMLMessage{
+		Text:         &text,
+		QuickReplies: []convai.XMLQR{{Text: "Pizza", Value: &value}, {Text: "Call us", Phone: true}},
+	}}}}, nil
+}
+
+// newChat starts a server with the channel user cu1 and a chat as that user, writing to the returned buffer
+func newChat(handler convaitest.TriggerHandler) (*convaitest.Server, *chat, *bytes.Buffer) {
+	srv := convaitest.NewServer()
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+	srv.SetTriggerHandler(handler)
+
+	client := srv.Client()
+	out := &bytes.Buffer{}
+
+	return srv, &chat{client: client, conv: client.Converse("cu1"), out: out}, out
+}
+
+func TestChatSendsQuickReplyValues(t *testing.T) {
+	srv, c, out := newChat(menuHandler)
+	defer srv.Close()
+
+	if err := c.loop(strings.NewReader("menu\n1\n9\n/quit\nnot sent\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"bot: pick one\n", "  [1] Pizza\n", "  [2] Call us (phone)\n", "bot: pizza-42\n", "bot: 9\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected the output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	// /quit ends the loop, so the last line is never sent
+	if n := len(srv.Executions()); n != 3 {
+		t.Fatalf("expected 3 turns, got %d", n)
+	}
+}
+
+func TestChatPrintsSessionAndFlags(t *testing.T) {
+	srv, c, out := newChat(convaitest.EchoHandler)
+	defer srv.Close()
+
+	if err := c.loop(strings.NewReader("/flags\nhi\n/session\n/flags\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	session, _ := srv.Session("cu1")
+
+	for _, want := range []string{"no turns yet\n", "bot: hi\n", "session " + session.ID.String(), "context flags:", "user flags:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected the output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// config is read from $CONVAI_CONFIG or ~/.config/convai/config.json, flags and environment variables take precedence
+type config struct {
+	APIKey  string `json:"apiKey"`
+	BaseURL string `json:"baseUrl"`
+}
+
+func configPath() string {
+	if path := os.Getenv("CONVAI_CONFIG"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "convai", "config.json")
+}
+
+func loadConfig(path string) (*config, error) {
+	var cfg config
+
+	if path == "" {
+		return &cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
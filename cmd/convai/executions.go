@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func runExecutions(client *convai.Client, args []string) error {
+	return subcommand("executions", client, args, map[string]func(*convai.Client, []string) error{
+		"query": executionsQuery,
+		"tail":  executionsTail,
+	})
+}
+
+// replyText puts the text of the messages the bot sent in an execution on a single line, in the order they were sent
+func replyText(e *convai.Execution) string {
+	return strings.ReplaceAll(convai.NewReply(e).Text(), "\n", " / ")
+}
+
+func errorText(e *convai.Execution) string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func executionRow(e *convai.Execution) []string {
+	return []string{
+		e.ID.String(),
+		e.StartTime.Local().Format("2006-01-02 15:04:05"),
+		e.Channel,
+		e.ChannelUserID,
+		e.Text,
+		replyText(e),
+		errorText(e),
+	}
+}
+
+var executionHeader = []string{"ID", "START", "CHANNEL", "USER", "TEXT", "REPLY", "ERRORS"}
+
+func executionsQuery(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("executions query", flag.ExitOnError)
+	var where, sort multiFlag
+	flags.Var(&where, "where", "filter, repeatable: field=a,b field!=a field^=prefix field=low..high field? !field?")
+	flags.Var(&sort, "sort", "sort field, prefix with - for descending, repeatable (default -startTime)")
+	limit := flags.Int("limit", 20, "maximum number of executions")
+	offset := flags.Int("offset", 0, "number of executions to skip")
+	flags.Parse(args)
+
+	matcher := convai.NewExecutionMatcher().Limit(*limit).Offset(*offset)
+
+	for _, filter := range where {
+		if err := applyExecutionFilter(matcher, filter); err != nil {
+			return err
+		}
+	}
+
+	if len(sort) == 0 {
+		sort = multiFlag{"-startTime"}
+	}
+
+	for _, field := range sort {
+		if strings.HasPrefix(field, "-") {
+			matcher.SortDesc(field[1:])
+		} else {
+			matcher.SortAsc(field)
+		}
+	}
+
+	res, err := client.QueryExecutions(matcher)
+	if err != nil {
+		return err
+	}
+
+	return output(res, func() ([]string, [][]string) {
+		rows := make([][]string, 0, len(res.Executions))
+		for i := range res.Executions {
+			rows = append(rows, executionRow(&res.Executions[i]))
+		}
+
+		fmt.Fprintf(stdout, "%d of %d executions\n\n", len(res.Executions), res.Total)
+
+		return executionHeader, rows
+	})
+}
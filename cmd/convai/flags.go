@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// multiFlag collects every value of a flag that can be repeated
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// subcommand dispatches to one of the actions of a command group, e.g. "users get"
+func subcommand(group string, client *convai.Client, args []string, actions map[string]func(*convai.Client, []string) error) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(actions))
+		for name := range actions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(os.Stderr, "usage: convai %s <%s> [args]\n", group, strings.Join(names, "|"))
+		return errUsage
+	}
+
+	action, ok := actions[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown %s command %q\n", group, args[0])
+		return errUsage
+	}
+
+	return action(client, args[1:])
+}
+
+// parseAssignments turns key=value pairs into a map, values are kept as strings
+// A key:=value pair holds a JSON value instead, e.g. count:=3 or tags:=["a","b"]
+func parseAssignments(pairs []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(pairs))
+
+	for _, pair := range pairs {
+		eq := strings.Index(pair, "=")
+		if eq <= 0 || pair[:eq] == ":" {
+			return nil, fmt.Errorf("expected key=value or key:=json, got %q", pair)
+		}
+
+		key, typed := pair[:eq], false
+		if strings.HasSuffix(key, ":") {
+			key, typed = strings.TrimSuffix(key, ":"), true
+		}
+
+		value, err := parseValue(pair[eq+1:], typed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// parseValue returns raw as it is, or decodes it as JSON when the value is typed
+func parseValue(raw string, typed bool) (interface{}, error) {
+	if !typed {
+		return raw, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// userFilterOps maps the operators of -where user filters to UserQuery operations
+var userFilterOps = map[string]int64{
+	"!=": convai.UQNotEquals,
+	"^=": convai.UQStartsWith,
+	"=":  convai.UQEquals,
+	">":  convai.UQGreaterThan,
+	"<":  convai.UQLessThan,
+}
+
+// executionFilterOps are the operators of -where execution filters
+var executionFilterOps = []string{"!=", "^=", "="}
+
+// splitFilter splits a filter on the operator that appears first in it, so a>b=c compares a with b=c
+// A filter starting with an operator or with a blank field is not split
+func splitFilter(filter string, ops []string) (field, op, value string, ok bool) {
+	at := -1
+
+	for _, candidate := range ops {
+		i := strings.Index(filter, candidate)
+		if i < 0 {
+			continue
+		}
+
+		if at < 0 || i < at {
+			at, op = i, candidate
+		}
+	}
+
+	if at <= 0 || strings.TrimSpace(filter[:at]) == "" {
+		return "", "", "", false
+	}
+
+	return filter[:at], op, filter[at+len(op):], true
+}
+
+// existsFilter parses field? and !field?, a trailing ? after an operator is part of the value instead
+func existsFilter(filter string, ops []string) (field string, negated, ok bool) {
+	if !strings.HasSuffix(filter, "?") {
+		return "", false, false
+	}
+
+	field = strings.TrimSuffix(filter, "?")
+	if _, _, _, hasOp := splitFilter(field, ops); hasOp {
+		return "", false, false
+	}
+
+	negated = strings.HasPrefix(field, "!")
+	if negated {
+		field = field[1:]
+	}
+
+	if strings.TrimSpace(field) == "" {
+		return "", false, false
+	}
+
+	return field, negated, true
+}
+
+func userFilterOpNames() []string {
+	ops := make([]string, 0, len(userFilterOps))
+	for op := range userFilterOps {
+		ops = append(ops, op)
+	}
+
+	return ops
+}
+
+// parseUserFilter parses a user filter such as field=a,b field!=a field^=prefix field>n field<n field? or !field?
+func parseUserFilter(filter string) (convai.QueryCheck, error) {
+	ops := userFilterOpNames()
+
+	if field, negated, ok := existsFilter(filter, ops); ok {
+		if negated {
+			return convai.QueryCheck{Field: field, Operation: convai.UQNotExists, Values: []string{}}, nil
+		}
+
+		return convai.QueryCheck{Field: field, Operation: convai.UQExists, Values: []string{}}, nil
+	}
+
+	field, op, value, ok := splitFilter(filter, ops)
+	if !ok {
+		return convai.QueryCheck{}, fmt.Errorf("invalid filter %q", filter)
+	}
+
+	return convai.QueryCheck{
+		Field:     field,
+		Operation: userFilterOps[op],
+		Values:    strings.Split(value, ","),
+	}, nil
+}
+
+// userQueryFlags registers the flags that build a UserQuery
+type userQueryFlags struct {
+	where         multiFlag
+	mode          *string
+	limit         *int
+	offset        *int
+	channelSearch *bool
+}
+
+func addUserQueryFlags(flags *flag.FlagSet) *userQueryFlags {
+	q := &userQueryFlags{}
+
+	flags.Var(&q.where, "where", "filter, repeatable: field=a,b field!=a field^=prefix field>n field<n field? !field?")
+	q.mode = flags.String("mode", "all", "how filters combine: all, any or none")
+	q.limit = flags.Int("limit", 10, "maximum number of users")
+	q.offset = flags.Int("offset", 0, "number of users to skip")
+	q.channelSearch = flags.Bool("channel-search", false, "search channel users instead of super users")
+
+	return q
+}
+
+func (q *userQueryFlags) build() (*convai.UserQuery, error) {
+	query := &convai.UserQuery{
+		Checks:        []convai.QueryCheck{},
+		Limit:         *q.limit,
+		Offset:        *q.offset,
+		ChannelSearch: *q.channelSearch,
+	}
+
+	switch *q.mode {
+	case "all":
+		query.Mode = convai.UQMAll
+	case "any":
+		query.Mode = convai.UQMAny
+	case "none":
+		query.Mode = convai.UQMNone
+	default:
+		return nil, fmt.Errorf("invalid mode %q", *q.mode)
+	}
+
+	for _, filter := range q.where {
+		check, err := parseUserFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		query.Checks = append(query.Checks, check)
+	}
+
+	return query, nil
+}
+
+// applyExecutionFilter adds a filter such as field=a,b field!=a field^=prefix field=low..high field? or !field?
+func applyExecutionFilter(matcher *convai.ExecutionMatcher, filter string) error {
+	if field, negated, ok := existsFilter(filter, executionFilterOps); ok {
+		if negated {
+			matcher.Where(field).Not().Exists()
+		} else {
+			matcher.Where(field).Exists()
+		}
+
+		return nil
+	}
+
+	field, op, value, ok := splitFilter(filter, executionFilterOps)
+	if !ok {
+		return fmt.Errorf("invalid filter %q", filter)
+	}
+
+	switch op {
+	case "!=":
+		matcher.Where(field).Not().Equals(strings.Split(value, ",")...)
+	case "^=":
+		matcher.Where(field).HasPrefix(value)
+	default:
+		if bounds := strings.SplitN(value, "..", 2); len(bounds) == 2 {
+			matcher.Where(field).Between(bounds[0], bounds[1], true)
+		} else {
+			matcher.Where(field).Equals(strings.Split(value, ",")...)
+		}
+	}
+
+	return nil
+}
+
+// confirm asks the user to confirm an action on stdin
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+
+	var answer string
+	fmt.Scanln(&answer)
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFilter(t *testing.T) {
+	ops := userFilterOpNames()
+
+	tests := []struct {
+		filter, field, op, value string
+		ok                       bool
+	}{
+		{"name=ada", "name", "=", "ada", true},
+		{"name!=ada", "name", "!=", "ada", true},
+		{"name^=a", "name", "^=", "a", true},
+		{"age>30", "age", ">", "30", true},
+		{"age<30", "age", "<", "30", true},
+		{"a>b=c", "a", ">", "b=c", true},
+		{"url=a=b", "url", "=", "a=b", true},
+		{"name=", "name", "=", "", true},
+		{"=ada", "", "", "", false},
+		{" =ada", "", "", "", false},
+		{"name", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		field, op, value, ok := splitFilter(test.filter, ops)
+		if field != test.field || op != test.op || value != test.value || ok != test.ok {
+			t.Fatalf("%q: expected %q %q %q %t, got %q %q %q %t", test.filter, test.field, test.op, test.value, test.ok, field, op, value, ok)
+		}
+	}
+}
+
+func TestExistsFilter(t *testing.T) {
+	ops := userFilterOpNames()
+
+	tests := []struct {
+		filter, field string
+		negated, ok   bool
+	}{
+		{"email?", "email", false, true},
+		{"!email?", "email", true, true},
+		{"email", "", false, false},
+		{"q=why?", "", false, false},
+		{"?", "", false, false},
+		{"!?", "", false, false},
+	}
+
+	for _, test := range tests {
+		field, negated, ok := existsFilter(test.filter, ops)
+		if field != test.field || negated != test.negated || ok != test.ok {
+			t.Fatalf("%q: expected %q %t %t, got %q %t %t", test.filter, test.field, test.negated, test.ok, field, negated, ok)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		raw   string
+		typed bool
+		value interface{}
+		ok    bool
+	}{
+		{"15551234", false, "15551234", true},
+		{"true", false, "true", true},
+		{`{"a":1}`, false, `{"a":1}`, true},
+		{"15551234", true, float64(15551234), true},
+		{"true", true, true, true},
+		{`["a","b"]`, true, []interface{}{"a", "b"}, true},
+		{"ada", true, nil, false},
+	}
+
+	for _, test := range tests {
+		value, err := parseValue(test.raw, test.typed)
+		if (err == nil) != test.ok || !reflect.DeepEqual(value, test.value) {
+			t.Fatalf("%q typed %t: expected %#v, got %#v and %v", test.raw, test.typed, test.value, value, err)
+		}
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	values, err := parseAssignments([]string{"phone=15551234", "age:=42", "url=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"phone": "15551234", "age": float64(42), "url": "a=b"}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("expected %v, got %v", want, values)
+	}
+
+	for _, pair := range []string{"phone", "=1", ":=1", "age:=forty"} {
+		if _, err := parseAssignments([]string{pair}); err == nil {
+			t.Fatalf("%q: expected an error", pair)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Command convai is a command line client for the Convai API
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+type command struct {
+	usage string
+	run   func(client *convai.Client, args []string) error
+}
+
+var commands = map[string]command{
+	"chat":       {usage: "chat with a bot as a channel user", run: runChat},
+	"users":      {usage: "query, get, create, merge, delete and update users", run: runUsers},
+	"sessions":   {usage: "get, update and reset sessions", run: runSessions},
+	"executions": {usage: "query and tail executions", run: runExecutions},
+	"broadcast":  {usage: "count reachable users and send broadcasts", run: runBroadcast},
+}
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	flags := flag.NewFlagSet("convai", flag.ExitOnError)
+	apiKey := flags.String("api-key", "", "API key, defaults to $CONVAI_API_KEY")
+	baseURL := flags.String("base-url", "", "API base URL, defaults to $CONVAI_BASE_URL or the production API")
+	configFile := flags.String("config", configPath(), "config file holding apiKey and baseUrl")
+	flags.StringVar(&outputFormat, "output", "table", "output format, table or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: convai [flags] <command> [args]\n\ncommands:\n")
+
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(flags.Output(), "  %-12s %s\n", name, commands[name].usage)
+		}
+
+		fmt.Fprintf(flags.Output(), "\nflags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if outputFormat != "table" && outputFormat != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", outputFormat)
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	client, err := newClient(*apiKey, *baseURL, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := cmd.run(client, flags.Args()[1:]); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func newClient(apiKey, baseURL string, cfg *config) (*convai.Client, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("CONVAI_API_KEY")
+	}
+
+	if apiKey == "" {
+		apiKey = cfg.APIKey
+	}
+
+	if apiKey == "" {
+		return nil, errors.New("no API key, pass -api-key, set CONVAI_API_KEY or add apiKey to the config file")
+	}
+
+	if baseURL == "" {
+		baseURL = os.Getenv("CONVAI_BASE_URL")
+	}
+
+	if baseURL == "" {
+		baseURL = cfg.BaseURL
+	}
+
+	opts := []convai.Option{
+		convai.WithUserAgent(convai.DefaultUserAgent + " (cli)"),
+	}
+
+	if baseURL != "" {
+		opts = append(opts, convai.WithBaseURL(baseURL))
+	}
+
+	return convai.NewClient(apiKey, opts...), nil
+}
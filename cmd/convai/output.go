@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputFormat is set by the -output flag
+var outputFormat = "table"
+
+// stdout is where commands write their results, tests replace it to inspect the output
+var stdout io.Writer = os.Stdout
+
+// output prints v as JSON, or as a table built by table when the table format is selected
+func output(v interface{}, table func() ([]string, [][]string)) error {
+	if outputFormat == "json" || table == nil {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	header, rows := table()
+	return printTable(header, rows)
+}
+
+func printTable(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = truncate(strings.Replace(cell, "\n", " ", -1), 60)
+		}
+
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+
+	return string(r[:max-3]) + "..."
+}
+
+func compactJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func runSessions(client *convai.Client, args []string) error {
+	return subcommand("sessions", client, args, map[string]func(*convai.Client, []string) error{
+		"get":    sessionsGet,
+		"update": sessionsUpdate,
+		"reset":  sessionsReset,
+	})
+}
+
+func sessionTable(session *convai.Session) func() ([]string, [][]string) {
+	return func() ([]string, [][]string) {
+		rows := [][]string{}
+		for i, frame := range session.Stack.Frames {
+			rows = append(rows, []string{
+				fmt.Sprint(i),
+				fmt.Sprint(frame.Module),
+				fmt.Sprint(frame.Node),
+				compactJSON(frame.Vars),
+			})
+		}
+
+		fmt.Fprintf(stdout, "session %s version %s data %s\n\n", session.ID.String(), session.Version, compactJSON(session.FData))
+
+		return []string{"FRAME", "MODULE", "NODE", "VARS"}, rows
+	}
+}
+
+func channelUserArg(flags *flag.FlagSet) (string, error) {
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: convai %s <channel-user-id>\n", flags.Name())
+		return "", errUsage
+	}
+
+	return flags.Arg(0), nil
+}
+
+func sessionsGet(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("sessions get", flag.ExitOnError)
+	flags.Parse(args)
+
+	id, err := channelUserArg(flags)
+	if err != nil {
+		return err
+	}
+
+	session, err := client.GetSession(id)
+	if err != nil {
+		return err
+	}
+
+	return output(session, sessionTable(session))
+}
+
+func sessionsUpdate(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("sessions update", flag.ExitOnError)
+	var set, del multiFlag
+	flags.Var(&set, "set", "session data to set as key=value or key:=json, repeatable")
+	flags.Var(&del, "delete", "session data key to delete, repeatable")
+	flags.Parse(args)
+
+	id, err := channelUserArg(flags)
+	if err != nil {
+		return err
+	}
+
+	input, err := updateInput(set, del)
+	if err != nil {
+		return err
+	}
+
+	session, err := client.UpdateSession(id, input)
+	if err != nil {
+		return err
+	}
+
+	return output(session, sessionTable(session))
+}
+
+func sessionsReset(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("sessions reset", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	flags.Parse(args)
+
+	id, err := channelUserArg(flags)
+	if err != nil {
+		return err
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("reset the session of %s?", id)) {
+		return nil
+	}
+
+	session, err := client.DeleteSession(id)
+	if err != nil {
+		return err
+	}
+
+	return output(session, sessionTable(session))
+}
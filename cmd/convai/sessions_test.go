@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+// captureOutput runs fn in the given output format and returns what it wrote
+func captureOutput(t *testing.T, format string, fn func() error) string {
+	var buf bytes.Buffer
+
+	oldStdout, oldFormat := stdout, outputFormat
+	stdout, outputFormat = &buf, format
+	defer func() { stdout, outputFormat = oldStdout, oldFormat }()
+
+	if err := fn(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestSessionsUpdateOutput(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	client := srv.Client()
+
+	table := captureOutput(t, "table", func() error {
+		return sessionsUpdate(client, []string{"-set", "plan=42", "cu1"})
+	})
+
+	lines := strings.Split(table, "\n")
+	if !strings.HasPrefix(lines[0], "session ") || !strings.HasSuffix(lines[0], `data {"plan":"42"}`) {
+		t.Fatalf("expected the session line first, got %q", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[2], "FRAME") {
+		t.Fatalf("expected the frame table after the session line, got:\n%s", table)
+	}
+
+	raw := captureOutput(t, "json", func() error {
+		return sessionsGet(client, []string{"cu1"})
+	})
+
+	var session convai.Session
+	if err := json.Unmarshal([]byte(raw), &session); err != nil {
+		t.Fatalf("expected the session as JSON, got %q: %v", raw, err)
+	}
+
+	if session.FData["plan"] != "42" {
+		t.Fatalf("expected the updated data, got %v", session.FData)
+	}
+}
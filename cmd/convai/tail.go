@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// tailEnd is used as the upper bound of the startTime window, the API needs both bounds
+const tailEnd = "9999-12-31T23:59:59Z"
+
+func executionsTail(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("executions tail", flag.ExitOnError)
+	var where multiFlag
+	flags.Var(&where, "where", "extra filter, repeatable: field=a,b field!=a field^=prefix field? !field?")
+	channel := flags.String("channel", "", "only show executions on this channel")
+	user := flags.String("user", "", "only show executions of this super user ID")
+	channelUser := flags.String("channel-user", "", "only show executions of this channel user ID")
+	errorsOnly := flags.Bool("errors", false, "only show executions that reported errors")
+	since := flags.Duration("since", 0, "also show executions that started this long ago")
+	interval := flags.Duration("interval", 2*time.Second, "how often to poll for new executions")
+	limit := flags.Int("limit", 100, "maximum number of executions fetched per poll")
+	flags.Parse(args)
+
+	t := &tail{
+		client:     client,
+		errorsOnly: *errorsOnly,
+		limit:      *limit,
+		cursor:     time.Now().Add(-*since).UTC(),
+		seen:       make(map[string]bool),
+	}
+
+	t.filters = func(matcher *convai.ExecutionMatcher) error {
+		if *channel != "" {
+			matcher.Where("channel").Equals(*channel)
+		}
+
+		if *user != "" {
+			matcher.Where("userId").Equals(*user)
+		}
+
+		if *channelUser != "" {
+			matcher.Where("channelUserId").Equals(*channelUser)
+		}
+
+		for _, filter := range where {
+			if err := applyExecutionFilter(matcher, filter); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// Check the filters once up front, an invalid one would otherwise fail every poll
+	if err := t.filters(convai.NewExecutionMatcher()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	for {
+		if err := t.poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			fmt.Fprintf(os.Stderr, "! %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+type tail struct {
+	client     *convai.Client
+	filters    func(matcher *convai.ExecutionMatcher) error
+	errorsOnly bool
+	limit      int
+
+	// cursor is the start time of the newest execution printed so far, seen holds the IDs printed
+	// at exactly that time, since the window includes its lower bound
+	cursor time.Time
+	seen   map[string]bool
+}
+
+// poll prints every execution that started since the cursor, fetching more pages while they are full
+func (t *tail) poll(ctx context.Context) error {
+	for {
+		matcher := convai.NewExecutionMatcher().Limit(t.limit)
+
+		if err := t.filters(matcher); err != nil {
+			return err
+		}
+
+		matcher.Where("startTime").Between(t.cursor.Format(time.RFC3339Nano), tailEnd, true)
+		matcher.SortAsc("startTime")
+
+		res, err := t.client.QueryExecutionsWithContext(ctx, matcher)
+		if err != nil {
+			return err
+		}
+
+		fresh := 0
+		for i := range res.Executions {
+			e := &res.Executions[i]
+			id := e.ID.String()
+
+			if t.seen[id] {
+				continue
+			}
+			fresh++
+
+			start := e.StartTime.UTC()
+			if start.After(t.cursor) {
+				t.cursor = start
+				t.seen = make(map[string]bool)
+			}
+			t.seen[id] = true
+
+			if t.errorsOnly && len(e.Errors) == 0 {
+				continue
+			}
+
+			if err := t.print(e); err != nil {
+				return err
+			}
+		}
+
+		// A full page of executions sharing the cursor's timestamp cannot be paged past, so stop rather than spin
+		if len(res.Executions) < t.limit || fresh == 0 {
+			return nil
+		}
+	}
+}
+
+func (t *tail) print(e *convai.Execution) error {
+	if outputFormat == "json" {
+		return json.NewEncoder(os.Stdout).Encode(e)
+	}
+
+	fmt.Printf("%s %s %s\n", e.StartTime.Local().Format("15:04:05.000"), e.Channel, e.ChannelUserID)
+
+	if e.Text != "" {
+		fmt.Printf("  user: %s\n", e.Text)
+	}
+
+	if reply := replyText(e); reply != "" {
+		fmt.Printf("  bot:  %s\n", reply)
+	}
+
+	for _, err := range e.Errors {
+		fmt.Printf("  ! %s error: %s\n", err.ErrorType, err.Message)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func TestApplyExecutionFilter(t *testing.T) {
+	low, high := "1", "5"
+
+	tests := []struct {
+		filter  string
+		item    convai.ExecutionQueryItem
+		negated bool
+	}{
+		{"channel=sms,web", convai.ExecutionQueryItem{Op: convai.EQEquals, Field: "channel", Matcher: []string{"sms", "web"}}, false},
+		{"channel!=sms", convai.ExecutionQueryItem{Op: convai.EQEquals, Field: "channel", Matcher: []string{"sms"}}, true},
+		{"text^=hel", convai.ExecutionQueryItem{Op: convai.EQHasPrefix, Field: "text", Matcher: []string{"hel"}}, false},
+		{"duration=1..5", convai.ExecutionQueryItem{Op: convai.EQBetweenInclusive, Field: "duration", LowerBound: &low, UpperBound: &high}, false},
+		{"errors?", convai.ExecutionQueryItem{Op: convai.EQExists, Field: "errors"}, false},
+		{"!errors?", convai.ExecutionQueryItem{Op: convai.EQExists, Field: "errors"}, true},
+		{"text=why?", convai.ExecutionQueryItem{Op: convai.EQEquals, Field: "text", Matcher: []string{"why?"}}, false},
+	}
+
+	for _, test := range tests {
+		matcher := convai.NewExecutionMatcher()
+
+		if err := applyExecutionFilter(matcher, test.filter); err != nil {
+			t.Fatalf("%s: %s", test.filter, err)
+		}
+
+		if !reflect.DeepEqual(*matcher.CurrentItem, test.item) || matcher.NegateCurrent != test.negated {
+			t.Fatalf("%s: expected %+v negated %t, got %+v negated %t", test.filter, test.item, test.negated, *matcher.CurrentItem, matcher.NegateCurrent)
+		}
+	}
+
+	for _, filter := range []string{"channel", "=sms", "^=a"} {
+		if err := applyExecutionFilter(convai.NewExecutionMatcher(), filter); err == nil {
+			t.Fatalf("%s: expected the filter to be invalid", filter)
+		}
+	}
+}
+
+func TestTailRejectsInvalidFilterBeforePolling(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request, got %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	if err := executionsTail(client, []string{"-where", "channel"}); err == nil {
+		t.Fatal("expected the invalid filter to be reported")
+	}
+}
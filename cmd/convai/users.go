@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+func runUsers(client *convai.Client, args []string) error {
+	return subcommand("users", client, args, map[string]func(*convai.Client, []string) error{
+		"query":       usersQuery,
+		"get":         usersGet,
+		"create":      usersCreate,
+		"merge":       usersMerge,
+		"delete":      usersDelete,
+		"update-data": usersUpdateData,
+	})
+}
+
+func usersTable(users []convai.SuperUser) func() ([]string, [][]string) {
+	return func() ([]string, [][]string) {
+		rows := make([][]string, 0, len(users))
+		for _, u := range users {
+			channels := make([]string, 0, len(u.ChannelUsers))
+			for _, cu := range u.ChannelUsers {
+				channels = append(channels, cu.Channel+":"+cu.ChannelId)
+			}
+
+			created := ""
+			if u.CreatedAt != nil {
+				created = u.CreatedAt.Format("2006-01-02 15:04")
+			}
+
+			rows = append(rows, []string{u.ID.String(), created, strings.Join(channels, " "), compactJSON(u.Data)})
+		}
+
+		return []string{"ID", "CREATED", "CHANNELS", "DATA"}, rows
+	}
+}
+
+func usersQuery(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users query", flag.ExitOnError)
+	q := addUserQueryFlags(flags)
+	flags.Parse(args)
+
+	query, err := q.build()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.QueryUsers(query)
+	if err != nil {
+		return err
+	}
+
+	return output(res, usersTable(res.Users))
+}
+
+func parseUUIDArg(flags *flag.FlagSet, name string) (uuid.UUID, error) {
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: convai %s <%s>\n", flags.Name(), name)
+		return uuid.Nil, errUsage
+	}
+
+	id, err := uuid.FromString(flags.Arg(0))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s %q: %w", name, flags.Arg(0), err)
+	}
+
+	return id, nil
+}
+
+func usersGet(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users get", flag.ExitOnError)
+	flags.Parse(args)
+
+	id, err := parseUUIDArg(flags, "super-user-id")
+	if err != nil {
+		return err
+	}
+
+	user, err := client.GetSuperUser(id)
+	if err != nil {
+		return err
+	}
+
+	return output(user, usersTable([]convai.SuperUser{*user}))
+}
+
+func usersCreate(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ExitOnError)
+	env := flags.String("env", "", "environment ID (required)")
+	superUser := flags.String("super-user", "", "add the channel users to this existing super user instead, cannot be combined with -data")
+	var data, channels multiFlag
+	flags.Var(&data, "data", "user data as key=value or key:=json, repeatable")
+	flags.Var(&channels, "channel", "channel user as channel:id, repeatable")
+	flags.Parse(args)
+
+	envID, err := uuid.FromString(*env)
+	if err != nil {
+		return fmt.Errorf("invalid -env %q: %w", *env, err)
+	}
+
+	userData, err := parseAssignments(data)
+	if err != nil {
+		return err
+	}
+
+	channelUsers := []convai.CreateChannelUser{}
+	for _, c := range channels {
+		parts := strings.SplitN(c, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("expected channel:id, got %q", c)
+		}
+
+		channelUsers = append(channelUsers, convai.CreateChannelUser{Channel: parts[0], ChannelID: parts[1]})
+	}
+
+	if *superUser != "" {
+		// Channel users are created without data, so the data would be dropped
+		if len(data) > 0 {
+			return fmt.Errorf("-data cannot be combined with -super-user, set it with users update-data")
+		}
+
+		superUserID, err := uuid.FromString(*superUser)
+		if err != nil {
+			return fmt.Errorf("invalid -super-user %q: %w", *superUser, err)
+		}
+
+		res, err := client.CreateChannelUsers(&convai.CreateChannelUsersRequest{
+			EnvironmentID: envID,
+			SuperUserID:   superUserID,
+			ChannelUsers:  channelUsers,
+		})
+		if err != nil {
+			return err
+		}
+
+		return output(res, func() ([]string, [][]string) {
+			return []string{"SUPER USER", "CHANNEL USERS"}, [][]string{{superUserID.String(), strings.Join(res.ChannelUserIDs, " ")}}
+		})
+	}
+
+	res, err := client.CreateSuperUser(&convai.CreateCombinedUserRequest{
+		EnvironmentID: envID,
+		UserData:      userData,
+		ChannelUsers:  channelUsers,
+	})
+	if err != nil {
+		return err
+	}
+
+	return output(res, func() ([]string, [][]string) {
+		return []string{"SUPER USER", "CHANNEL USERS"}, [][]string{{res.SuperUserID.String(), strings.Join(res.ChannelUserIDs, " ")}}
+	})
+}
+
+func usersMerge(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users merge", flag.ExitOnError)
+	preferNew := flags.String("prefer-new", "", "comma separated data fields to take from the newest user")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: convai users merge [-prefer-new fields] <super-user-id> <super-user-id>...")
+		return errUsage
+	}
+
+	req := &convai.MergeUsersRequest{}
+	for _, arg := range flags.Args() {
+		id, err := uuid.FromString(arg)
+		if err != nil {
+			return fmt.Errorf("invalid super user ID %q: %w", arg, err)
+		}
+
+		req.SuperUserIDs = append(req.SuperUserIDs, id)
+	}
+
+	if *preferNew != "" {
+		req.PreferNewUserFields = strings.Split(*preferNew, ",")
+	}
+
+	user, err := client.MergeUsers(req)
+	if err != nil {
+		return err
+	}
+
+	return output(user, usersTable([]convai.SuperUser{*user}))
+}
+
+func usersDelete(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users delete", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	forget := flags.Bool("forget", false, "also delete the user's sessions and channel users")
+	flags.Parse(args)
+
+	id, err := parseUUIDArg(flags, "super-user-id")
+	if err != nil {
+		return err
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("delete super user %s?", id.String())) {
+		return nil
+	}
+
+	if *forget {
+		report, err := client.ForgetUser(context.Background(), id, nil)
+		if report != nil {
+			if outErr := output(report, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(report.Actions))
+				for _, a := range report.Actions {
+					rows = append(rows, []string{a.Kind, a.ID, a.Status, a.Error})
+				}
+				return []string{"KIND", "ID", "STATUS", "ERROR"}, rows
+			}); outErr != nil {
+				return outErr
+			}
+		}
+
+		return err
+	}
+
+	user, err := client.DeleteSuperUser(id)
+	if err != nil {
+		return err
+	}
+
+	return output(user, usersTable([]convai.SuperUser{*user}))
+}
+
+func usersUpdateData(client *convai.Client, args []string) error {
+	flags := flag.NewFlagSet("users update-data", flag.ExitOnError)
+	var set, del multiFlag
+	flags.Var(&set, "set", "data to set as key=value or key:=json, repeatable")
+	flags.Var(&del, "delete", "data key to delete, repeatable")
+	flags.Parse(args)
+
+	id, err := parseUUIDArg(flags, "super-user-id")
+	if err != nil {
+		return err
+	}
+
+	input, err := updateInput(set, del)
+	if err != nil {
+		return err
+	}
+
+	user, err := client.UpdateUserData(id.String(), input)
+	if err != nil {
+		return err
+	}
+
+	return output(user, usersTable([]convai.SuperUser{*user}))
+}
+
+func updateInput(set, del []string) (*convai.UpdateUserDataInput, error) {
+	values, err := parseAssignments(set)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 && len(del) == 0 {
+		return nil, fmt.Errorf("nothing to update, pass -set or -delete")
+	}
+
+	return &convai.UpdateUserDataInput{
+		Set:    values,
+		Delete: append([]string{}, del...),
+	}, nil
+}
@@ -0,0 +1,366 @@
+package convai
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v4"
+	"github.com/vmihailenco/msgpack/v4/codes"
+)
+
+// Codec encodes request bodies and decodes response bodies for a wire format
+type Codec interface {
+	// ContentType is the media type sent in the Content-Type and Accept headers
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec is the default wire format
+	JSONCodec Codec = jsonCodec{}
+
+	// MsgpackCodec uses MessagePack, which is considerably smaller and faster for large execution queries
+	// Fields without a msgpack tag fall back to their json tag
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+// WithCodec sets the wire format used for request bodies and requested for responses
+// Responses are decoded according to their Content-Type, so a server that only speaks JSON keeps working
+func WithCodec(codec Codec) Option {
+	return func(o *clientOptions) {
+		o.codec = codec
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	d := msgpack.NewDecoder(bytes.NewReader(data)).UseJSONTag(true)
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return d.Decode(v)
+	}
+
+	return decodeMsgpack(d, rv.Elem())
+}
+
+// msgpack decodes *time.Time through encoding.BinaryUnmarshaler, which cannot read the timestamp extension it
+// encodes times with. Registering a decoder for *time.Time would change decoding for every user of the msgpack
+// package in the binary, so the codec walks the types holding optional timestamps itself and leaves every
+// other value to msgpack
+func decodeMsgpack(d *msgpack.Decoder, v reflect.Value) error {
+	if !holdsTimePtr(v.Type()) {
+		return d.DecodeValue(v)
+	}
+
+	if v.Type() == timePtrType {
+		return decodeTimePtr(d, v)
+	}
+
+	code, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	if code == codes.Nil {
+		v.Set(reflect.Zero(v.Type()))
+		return d.DecodeNil()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return decodeMsgpack(d, v.Elem())
+	case reflect.Slice:
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			if err := decodeMsgpack(d, v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Map:
+		n, err := d.DecodeMapLen()
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.DecodeValue(key); err != nil {
+				return err
+			}
+
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeMsgpack(d, value); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(key, value)
+		}
+
+		return nil
+	case reflect.Struct:
+		return decodeMsgpackStruct(d, v, code)
+	}
+
+	return d.DecodeValue(v)
+}
+
+// decodeMsgpackStruct decodes a struct encoded as a map of field names, or as an array of fields in order
+func decodeMsgpackStruct(d *msgpack.Decoder, v reflect.Value, code codes.Code) error {
+	fields := msgpackFields(v.Type())
+
+	if codes.IsFixedArray(code) || code == codes.Array16 || code == codes.Array32 {
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			if i >= len(fields.order) {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := decodeMsgpack(d, v.FieldByIndex(fields.order[i])); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+
+		index, ok := fields.byName[name]
+		if !ok {
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := decodeMsgpack(d, v.FieldByIndex(index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeTimePtr(d *msgpack.Decoder, v reflect.Value) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	if code == codes.Nil {
+		v.Set(reflect.Zero(v.Type()))
+		return d.DecodeNil()
+	}
+
+	t, err := d.DecodeTime()
+	if err != nil {
+		return err
+	}
+
+	v.Set(reflect.ValueOf(&t))
+
+	return nil
+}
+
+var (
+	timePtrType = reflect.TypeOf((*time.Time)(nil))
+
+	// timePtrTypes caches whether a type holds a *time.Time anywhere inside it
+	timePtrTypes sync.Map
+
+	// fieldsByType caches the fields of the structs decoded by decodeMsgpackStruct
+	fieldsByType sync.Map
+)
+
+func holdsTimePtr(typ reflect.Type) bool {
+	if held, ok := timePtrTypes.Load(typ); ok {
+		return held.(bool)
+	}
+
+	held := findTimePtr(typ, map[reflect.Type]bool{})
+	timePtrTypes.Store(typ, held)
+
+	return held
+}
+
+func findTimePtr(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if typ == timePtrType {
+		return true
+	}
+
+	// Types decoding themselves are left to msgpack, and recursive types are only walked once
+	if seen[typ] || typ.Implements(customDecoderType) || reflect.PtrTo(typ).Implements(customDecoderType) {
+		return false
+	}
+	seen[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return findTimePtr(typ.Elem(), seen)
+	case reflect.Map:
+		return findTimePtr(typ.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if findTimePtr(typ.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+var customDecoderType = reflect.TypeOf((*msgpack.CustomDecoder)(nil)).Elem()
+
+type structFields struct {
+	byName map[string][]int
+	order  [][]int
+}
+
+// msgpackFields names the fields of a struct the way msgpack does with UseJSONTag: the msgpack tag first,
+// then the json tag, then the field name. Untagged embedded structs are inlined
+func msgpackFields(typ reflect.Type) *structFields {
+	if fields, ok := fieldsByType.Load(typ); ok {
+		return fields.(*structFields)
+	}
+
+	fields := &structFields{byName: make(map[string][]int)}
+	collectFields(fields, typ, nil)
+	fieldsByType.Store(typ, fields)
+
+	return fields
+}
+
+func collectFields(fields *structFields, typ reflect.Type, parent []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		embedded := f.Anonymous && f.Type.Kind() == reflect.Struct
+		if f.PkgPath != "" && !embedded {
+			continue
+		}
+
+		tag, ok := f.Tag.Lookup("msgpack")
+		if !ok {
+			tag = f.Tag.Get("json")
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		index := append(append([]int{}, parent...), i)
+
+		if embedded && name == "" {
+			collectFields(fields, f.Type, index)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields.byName[name] = index
+		fields.order = append(fields.order, index)
+	}
+}
+
+// knownCodecs maps the media types the client understands to their codec
+var knownCodecs = map[string]Codec{
+	"application/json":      JSONCodec,
+	"application/msgpack":   MsgpackCodec,
+	"application/x-msgpack": MsgpackCodec,
+}
+
+// accept builds the Accept header, preferring the client's codec but allowing JSON
+func (c *Client) accept() string {
+	if c.codec.ContentType() == JSONCodec.ContentType() {
+		return JSONCodec.ContentType()
+	}
+
+	return c.codec.ContentType() + ", " + JSONCodec.ContentType() + ";q=0.9"
+}
+
+// responseCodec picks the codec for a response based on its Content-Type
+func (c *Client) responseCodec(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return c.codec
+	}
+
+	if mediaType == c.codec.ContentType() {
+		return c.codec
+	}
+
+	if codec, ok := knownCodecs[mediaType]; ok {
+		return codec
+	}
+
+	return c.codec
+}
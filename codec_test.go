@@ -0,0 +1,120 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestMsgpackDecodesOptionalTimestamps(t *testing.T) {
+	created := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	data, err := convai.MsgpackCodec.Marshal(&convai.UserQueryResult{
+		Users: []convai.SuperUser{{
+			ID:           uuid.NewV4(),
+			CreatedAt:    &created,
+			Data:         map[string]interface{}{"name": "Ada"},
+			ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", UpdatedAt: &created}},
+		}},
+		Count: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res convai.UserQueryResult
+	if err := convai.MsgpackCodec.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	user := res.Users[0]
+
+	if user.CreatedAt == nil || !user.CreatedAt.Equal(created) {
+		t.Fatalf("expected createdAt %s, got %v", created, user.CreatedAt)
+	}
+
+	if user.UpdatedAt != nil {
+		t.Fatalf("expected a missing updatedAt to stay nil, got %v", user.UpdatedAt)
+	}
+
+	cu := user.ChannelUsers[0]
+	if cu.CreatedAt != nil || cu.UpdatedAt == nil || !cu.UpdatedAt.Equal(created) {
+		t.Fatalf("expected only the channel user's updatedAt to be set, got %v and %v", cu.CreatedAt, cu.UpdatedAt)
+	}
+
+	if user.Data["name"] != "Ada" || res.Count != 1 {
+		t.Fatalf("expected the other fields to be decoded, got %+v", res)
+	}
+}
+
+func TestMsgpackClientFallsBackToJSON(t *testing.T) {
+	created := time.Now().UTC().Truncate(time.Second)
+
+	var accept, contentType string
+
+	// The server answers in the format named by X-Format, standing in for an API that may only speak JSON
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept, contentType = r.Header.Get("Accept"), r.Header.Get("Content-Type")
+
+		codec := convai.JSONCodec
+		if r.Header.Get("X-Format") == "msgpack" {
+			codec = convai.MsgpackCodec
+		}
+
+		body, _ := codec.Marshal(&convai.UserQueryResult{Users: []convai.SuperUser{{CreatedAt: &created}}, Count: 1})
+		w.Header().Set("Content-Type", codec.ContentType())
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	for _, format := range []string{"msgpack", "json"} {
+		client := convai.NewClient("key",
+			convai.WithBaseURL(srv.URL),
+			convai.WithCodec(convai.MsgpackCodec),
+			convai.WithHeader("X-Format", format),
+		)
+
+		res, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if len(res.Users) != 1 || res.Users[0].CreatedAt == nil || !res.Users[0].CreatedAt.Equal(created) {
+			t.Fatalf("%s: expected the user's createdAt to be decoded, got %+v", format, res.Users)
+		}
+
+		if contentType != "application/msgpack" || accept != "application/msgpack, application/json;q=0.9" {
+			t.Fatalf("%s: expected a msgpack request accepting json, got %q accepting %q", format, contentType, accept)
+		}
+	}
+}
+
+func TestUnencodableBodyIsNotSent(t *testing.T) {
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	_, err := client.CreateSuperUserWithContext(context.Background(), &convai.CreateCombinedUserRequest{
+		UserData: convai.UserData{"callback": func() {}},
+	})
+
+	var encodeErr *convai.EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Path != "/users/super/create" {
+		t.Fatalf("expected an EncodeError for the create request, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Fatal("expected the request not to be sent")
+	}
+}
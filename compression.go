@@ -0,0 +1,63 @@
+package convai
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultGzipMinSize is the request body size from which WithGzip compresses when given a negative size
+const DefaultGzipMinSize = 1024
+
+// WithGzip compresses request bodies of at least minSize bytes and asks the API for gzipped responses
+// Small bodies are sent as is, since compressing them costs more than it saves
+func WithGzip(minSize int) Option {
+	return func(o *clientOptions) {
+		if minSize < 0 {
+			minSize = DefaultGzipMinSize
+		}
+
+		o.gzip = true
+		o.gzipMinSize = minSize
+	}
+}
+
+// compress gzips body when compression is enabled and the body is large enough
+func (c *Client) compress(body []byte) ([]byte, bool, error) {
+	if !c.gzip || len(body) < c.gzipMinSize {
+		return body, false, nil
+	}
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, false, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+
+	return buf.Bytes(), true, nil
+}
+
+// decompressBody wraps the response body in a gzip reader when the transport left it compressed
+// This happens whenever Accept-Encoding was set explicitly or a custom transport is used
+func decompressBody(res *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return res.Body, nil
+	}
+
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+
+	return zr, nil
+}
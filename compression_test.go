@@ -0,0 +1,128 @@
+package convai_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// gzipServer records whether each request body was gzipped and answers every request with a gzipped result
+type gzipServer struct {
+	*httptest.Server
+
+	encodings []string
+	bodies    [][]byte
+	accepted  []string
+}
+
+func newGzipServer(t *testing.T) *gzipServer {
+	s := &gzipServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		s.encodings = append(s.encodings, r.Header.Get("Content-Encoding"))
+		s.bodies = append(s.bodies, body)
+		s.accepted = append(s.accepted, r.Header.Get("Accept-Encoding"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		zw := gzip.NewWriter(w)
+		json.NewEncoder(zw).Encode(convai.UserQueryResult{Users: []convai.SuperUser{}, Count: 42})
+		zw.Close()
+	}))
+
+	return s
+}
+
+func queryWithChecks(n int) *convai.UserQuery {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = strings.Repeat("x", 16)
+	}
+
+	return convai.UserQueryBuilder().All().Where("id").Equals(values...).Build()
+}
+
+func TestGzipCompressesLargeRequests(t *testing.T) {
+	srv := newGzipServer(t)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithGzip(512))
+
+	for _, query := range []*convai.UserQuery{queryWithChecks(1), queryWithChecks(100)} {
+		res, err := client.QueryUsersWithContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Count != 42 {
+			t.Fatalf("expected the gzipped response to be decoded, got %+v", res)
+		}
+	}
+
+	if len(srv.bodies[0]) >= 512 || srv.encodings[0] != "" {
+		t.Fatalf("expected a %d byte body to be sent as is, got encoding %q", len(srv.bodies[0]), srv.encodings[0])
+	}
+
+	if len(srv.bodies[1]) < 512 || srv.encodings[1] != "gzip" {
+		t.Fatalf("expected a %d byte body to be gzipped, got encoding %q", len(srv.bodies[1]), srv.encodings[1])
+	}
+
+	var query convai.UserQuery
+	if err := json.Unmarshal(srv.bodies[1], &query); err != nil || len(query.Checks) != 1 {
+		t.Fatalf("expected the gzipped body to hold the query, got %s", srv.bodies[1])
+	}
+
+	for _, accepted := range srv.accepted {
+		if accepted != "gzip" {
+			t.Fatalf("expected gzipped responses to be requested, got %q", accepted)
+		}
+	}
+}
+
+func TestWithoutGzipSendsPlainRequests(t *testing.T) {
+	srv := newGzipServer(t)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	res, err := client.QueryUsersWithContext(context.Background(), queryWithChecks(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Count != 42 {
+		t.Fatalf("expected the gzipped response to be decoded, got %+v", res)
+	}
+
+	if srv.encodings[0] != "" {
+		t.Fatalf("expected the body to be sent as is, got encoding %q", srv.encodings[0])
+	}
+}
@@ -0,0 +1,455 @@
+package convaitest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// ErrNoInteraction is returned by a replaying cassette for a request it has no recording of
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// NoInteractionError describes a request a replaying cassette has no recording of
+// It is not retryable, as replaying the same request again cannot find a recording either
+type NoInteractionError struct {
+	Method   string
+	Path     string
+	Cassette string
+}
+
+func (n *NoInteractionError) Error() string {
+	return fmt.Sprintf("%s %s in cassette %s: %s", n.Method, n.Path, n.Cassette, ErrNoInteraction.Error())
+}
+
+func (n *NoInteractionError) Unwrap() error {
+	return ErrNoInteraction
+}
+
+// Retryable tells the client not to retry the request
+func (n *NoInteractionError) Retryable() bool {
+	return false
+}
+
+// Redacted replaces the values of redacted headers and fields
+const Redacted = "REDACTED"
+
+const (
+	// ModeReplay answers requests from the cassette file without touching the network
+	ModeReplay = iota
+
+	// ModeRecord sends requests to the real API and records them, the file is written by Save
+	ModeRecord
+)
+
+// Interaction is a recorded request along with the response it got
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a recorded request, bodies are stored decompressed
+type CassetteRequest struct {
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Query   string          `json:"query,omitempty"`
+	Header  http.Header     `json:"header"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody []byte          `json:"rawBody,omitempty"`
+}
+
+// CassetteResponse is a recorded response, bodies are stored decompressed
+type CassetteResponse struct {
+	StatusCode int             `json:"statusCode"`
+	Header     http.Header     `json:"header"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	RawBody    []byte          `json:"rawBody,omitempty"`
+}
+
+// Cassette is an http.RoundTripper that records API traffic to a fixture file and replays it offline
+// Use it with convai.WithHTTPClient(cassette.HTTPClient())
+type Cassette struct {
+	// RedactHeaders lists headers whose values are not recorded, Authorization is always redacted
+	RedactHeaders []string
+
+	// RedactFields lists fields whose values are not recorded, wherever they appear in a JSON or MessagePack body
+	// Recording fails for a body in any other format, as it cannot be redacted
+	RedactFields []string
+
+	// Transport sends requests while recording, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+
+	// Match decides whether a recorded interaction answers a request, by default the method, path, query and
+	// body must be equal. The body passed in is decompressed and redacted
+	Match func(r *http.Request, body []byte, recorded CassetteRequest) bool
+
+	path string
+	mode int
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewCassette creates a cassette backed by the file at path
+// In ModeReplay the file must exist, in ModeRecord it is overwritten by Save
+func NewCassette(path string, mode int) (*Cassette, error) {
+	c := &Cassette{
+		path:         path,
+		mode:         mode,
+		interactions: []Interaction{},
+	}
+
+	if mode != ModeReplay {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+
+	c.used = make([]bool, len(c.interactions))
+
+	return c, nil
+}
+
+// HTTPClient returns an http.Client that goes through the cassette
+func (c *Cassette) HTTPClient() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Interactions returns the recorded interactions
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Interaction{}, c.interactions...)
+}
+
+// Unused returns the recorded interactions that were not replayed, tests can check it is empty when they are done
+func (c *Cassette) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unused := []Interaction{}
+	for i, used := range c.used {
+		if !used {
+			unused = append(unused, c.interactions[i])
+		}
+	}
+
+	return unused
+}
+
+// Save writes the recorded interactions to the cassette file
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mode != ModeRecord {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, data, 0644)
+}
+
+func (c *Cassette) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := requestBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.mode == ModeRecord {
+		return c.record(r, body)
+	}
+
+	redacted, err := c.redactBody(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.replay(r, redacted)
+}
+
+func (c *Cassette) record(r *http.Request, body []byte) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := responseBody(res)
+	if err != nil {
+		return nil, err
+	}
+
+	req := CassetteRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: c.redactHeader(r.Header),
+	}
+
+	if req.Body, req.RawBody, err = c.storeBody(body, r.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+
+	recorded := CassetteResponse{
+		StatusCode: res.StatusCode,
+		Header:     c.redactHeader(res.Header),
+	}
+
+	if recorded.Body, recorded.RawBody, err = c.storeBody(resBody, res.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{Request: req, Response: recorded})
+	c.used = append(c.used, true)
+	c.mu.Unlock()
+
+	return newResponse(r, res.StatusCode, res.Header, resBody), nil
+}
+
+// replay answers with the first unused interaction that matches, so repeated identical requests replay in order
+func (c *Cassette) replay(r *http.Request, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	match := c.Match
+	if match == nil {
+		match = defaultMatch
+	}
+
+	for i, interaction := range c.interactions {
+		if c.used[i] || !match(r, body, interaction.Request) {
+			continue
+		}
+
+		c.used[i] = true
+
+		res := interaction.Response
+		resBody := []byte(res.Body)
+		if res.RawBody != nil {
+			resBody = res.RawBody
+		}
+
+		return newResponse(r, res.StatusCode, res.Header, resBody), nil
+	}
+
+	return nil, &NoInteractionError{Method: r.Method, Path: r.URL.Path, Cassette: c.path}
+}
+
+func defaultMatch(r *http.Request, body []byte, recorded CassetteRequest) bool {
+	if r.Method != recorded.Method || r.URL.Path != recorded.Path || r.URL.RawQuery != recorded.Query {
+		return false
+	}
+
+	if recorded.RawBody != nil {
+		return bytes.Equal(body, recorded.RawBody)
+	}
+
+	return bytes.Equal(canonicalJSON(body), canonicalJSON(recorded.Body))
+}
+
+// storeBody keeps JSON bodies readable in the file and stores anything else as raw bytes
+func (c *Cassette) storeBody(body []byte, contentType string) (json.RawMessage, []byte, error) {
+	if len(body) == 0 {
+		return nil, nil, nil
+	}
+
+	redacted, err := c.redactBody(body, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if json.Valid(redacted) {
+		return redacted, nil, nil
+	}
+
+	return nil, redacted, nil
+}
+
+// redactBody replaces the redacted fields of a JSON or MessagePack body
+func (c *Cassette) redactBody(body []byte, contentType string) ([]byte, error) {
+	if len(c.RedactFields) == 0 || len(body) == 0 {
+		return body, nil
+	}
+
+	fields := make(map[string]bool)
+	for _, f := range c.RedactFields {
+		fields[f] = true
+	}
+
+	if json.Valid(body) {
+		var v interface{}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&v); err != nil {
+			return nil, fmt.Errorf("redacting body: %w", err)
+		}
+
+		return json.Marshal(redactValue(v, fields))
+	}
+
+	if codecFor(contentType) == convai.MsgpackCodec {
+		var v interface{}
+		if err := msgpack.Unmarshal(body, &v); err != nil {
+			return nil, fmt.Errorf("redacting body: %w", err)
+		}
+
+		// Sorted keys keep the encoding stable, so a replayed request matches its recording
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf).SortMapKeys(true).Encode(redactValue(v, fields)); err != nil {
+			return nil, fmt.Errorf("redacting body: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("cannot redact a body of type %q", contentType)
+}
+
+func redactValue(v interface{}, fields map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if fields[k] {
+				v[k] = Redacted
+			} else {
+				v[k] = redactValue(child, fields)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child, fields)
+		}
+	}
+
+	return v
+}
+
+func (c *Cassette) redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+
+	// Bodies are stored decompressed, so the encoding headers no longer apply
+	redacted.Del("Content-Encoding")
+	redacted.Del("Content-Length")
+
+	for _, h := range append([]string{"Authorization"}, c.RedactHeaders...) {
+		if redacted.Get(h) != "" {
+			redacted.Set(h, Redacted)
+		}
+	}
+
+	return redacted
+}
+
+func canonicalJSON(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var v interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&v); err != nil {
+		return data
+	}
+
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+
+	return canonical
+}
+
+func requestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Restore the body for the real transport
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return gunzip(body)
+	}
+
+	return body, nil
+}
+
+func responseBody(res *http.Response) ([]byte, error) {
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return gunzip(body)
+	}
+
+	return body, nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(zr)
+}
+
+func newResponse(r *http.Request, status int, header http.Header, body []byte) *http.Response {
+	header = header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
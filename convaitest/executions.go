@@ -0,0 +1,194 @@
+package convaitest
+
+import (
+	"net/http"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (s *Server) queryExecutions(r *request) (interface{}, *apiError) {
+	var matcher convai.ExecutionMatcher
+	if err := r.decode(&matcher); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid query: %s", err.Error())
+	}
+
+	matched := s.matchExecutions(&matcher)
+
+	res := &convai.ExecutionQueryResult{
+		Executions: []convai.Execution{},
+		Total:      len(matched),
+	}
+
+	for _, i := range page(len(matched), matcher.Off, matcher.Lim) {
+		res.Executions = append(res.Executions, matched[i])
+	}
+
+	return res, nil
+}
+
+func (s *Server) getExecution(id string) (interface{}, *apiError) {
+	executionID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid execution id %q", id)
+	}
+
+	for _, execution := range s.executions {
+		if uuid.Equal(execution.ID, executionID) {
+			return &execution, nil
+		}
+	}
+
+	return nil, errorf(http.StatusNotFound, "execution %s not found", id)
+}
+
+func (s *Server) triggerExecution(r *request) (interface{}, *apiError) {
+	var req convai.TriggerRequest
+	if err := r.decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+	}
+
+	cu, ok := s.channelUsers[req.ChannelID]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "channel user %s not found", req.ChannelID)
+	}
+
+	return s.execute(&req, cu), nil
+}
+
+// broadcast triggers the bot for every channel user on the broadcast channel of the matched users
+func (s *Server) broadcast(r *request) (interface{}, *apiError) {
+	var input convai.BroadcastInput
+	if err := r.decode(&input); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+	}
+
+	s.broadcasts = append(s.broadcasts, input)
+
+	users := 0
+	matched := s.matchUsers(&input.UserQuery)
+
+	for _, i := range page(len(matched), input.UserQuery.Offset, input.UserQuery.Limit) {
+		user := matched[i]
+		reached := false
+
+		for _, cu := range s.sortedChannelUsers() {
+			if !uuid.Equal(cu.SuperUserID, user.ID) || (input.Channel != "" && cu.Channel != input.Channel) {
+				continue
+			}
+
+			s.execute(&convai.TriggerRequest{
+				ContextModifier: input.ContextModifier,
+				ChannelID:       cu.ChannelId,
+				IsTrigger:       true,
+			}, cu)
+
+			reached = true
+		}
+
+		if reached {
+			users++
+		}
+	}
+
+	return &convai.BroadcastResult{Status: "sent", Users: users}, nil
+}
+
+// execute runs the trigger handler as a channel user and records the execution
+// The lock must be held, it is released while the handler runs
+func (s *Server) execute(req *convai.TriggerRequest, cu *convai.ChannelUser) *convai.Execution {
+	start := time.Now().UTC()
+
+	session, ok := s.sessions[cu.ChannelId]
+	if !ok || req.IsStart {
+		fresh := newSession()
+		if ok {
+			fresh.ID = session.ID
+			fresh.FData = session.FData
+		}
+
+		session = fresh
+		s.sessions[cu.ChannelId] = session
+	}
+
+	if session.FData == nil {
+		session.FData = make(map[string]interface{})
+	}
+
+	var userData map[string]interface{}
+
+	user, hasUser := s.superUsers[cu.SuperUserID]
+	if hasUser {
+		userData = user.Data
+	}
+
+	rc := &convai.RequestContext{
+		Flaggable:       convai.NewFlaggable(nil),
+		ID:              uuid.NewV4(),
+		User:            convai.RequestUser{Flaggable: convai.NewFlaggable(copyMap(userData)), ID: cu.SuperUserID, ChannelID: cu.ChannelId},
+		Session:         *session,
+		EnvironmentData: make(map[string]interface{}),
+		Text:            req.Text,
+		Channel:         cu.Channel,
+		Source:          req.Source,
+		IsStart:         req.IsStart,
+		IsTrigger:       req.IsTrigger,
+	}
+
+	rc.Session.FData = copyMap(session.FData)
+
+	if req.ContextModifier != nil {
+		req.ContextModifier.Apply(rc)
+	}
+
+	session.FData = rc.Session.FData
+	if hasUser {
+		user.Data = rc.User.FData
+		if user.Data == nil {
+			user.Data = make(map[string]interface{})
+		}
+	}
+
+	view := s.channelUserView(cu)
+	handler := s.trigger
+
+	handled := *session
+	handled.FData = copyMap(session.FData)
+
+	// The handler runs without the lock, so it may call back into the server
+	s.mu.Unlock()
+	response, errs := handler(req, &view, &handled)
+	s.mu.Lock()
+
+	*session = handled
+
+	execution := convai.Execution{
+		ID:            rc.ID,
+		UserID:        cu.SuperUserID,
+		ChannelUserID: cu.ChannelId,
+		SessionID:     session.ID,
+		EnvironmentID: cu.EnvironmentID,
+		Data:          rc.FData,
+		UserData:      copyMap(rc.User.FData),
+		SessionData:   copyMap(session.FData),
+		Text:          req.Text,
+		Channel:       cu.Channel,
+		Source:        req.Source,
+		IsStart:       req.IsStart,
+		IsTrigger:     req.IsTrigger,
+		Errors:        append(rc.Errors, errs...),
+		Response:      response,
+		Logs:          []convai.ExecutionLog{},
+		StartTime:     start,
+	}
+
+	if execution.Errors == nil {
+		execution.Errors = []convai.ExecError{}
+	}
+
+	execution.ExecutionDuration = time.Since(start).Milliseconds()
+	s.executions = append(s.executions, execution)
+
+	return &execution
+}
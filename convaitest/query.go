@@ -0,0 +1,318 @@
+package convaitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// matchUsers returns the super users matching a query, oldest first, the lock must be held
+func (s *Server) matchUsers(query *convai.UserQuery) []*convai.SuperUser {
+	matched := []*convai.SuperUser{}
+
+	for _, user := range s.sortedSuperUsers() {
+		if query.ChannelSearch {
+			if s.matchChannelUsers(user, query) {
+				matched = append(matched, user)
+			}
+
+			continue
+		}
+
+		lookup := func(field string) (string, bool) {
+			if field == "id" {
+				return user.ID.String(), true
+			}
+
+			return lookupField(user.Data, field)
+		}
+
+		if matchChecks(query, lookup) {
+			matched = append(matched, user)
+		}
+	}
+
+	return matched
+}
+
+// matchChannelUsers matches a user when any of its channel users matches a channel search
+// The id field is a like search on the channel user ID, channel compares the channel exactly
+func (s *Server) matchChannelUsers(user *convai.SuperUser, query *convai.UserQuery) bool {
+	for _, cu := range s.sortedChannelUsers() {
+		if !uuid.Equal(cu.SuperUserID, user.ID) {
+			continue
+		}
+
+		cu := cu
+		lookup := func(field string) (string, bool) {
+			switch field {
+			case "id":
+				return cu.ChannelId, true
+			case "channel":
+				return cu.Channel, true
+			}
+
+			return lookupField(cu.Data, field)
+		}
+
+		if matchChecks(query, lookup) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchChecks(query *convai.UserQuery, lookup func(field string) (string, bool)) bool {
+	for _, check := range query.Checks {
+		value, present := lookup(check.Field)
+		ok := matchCheck(check, value, present, query.ChannelSearch)
+
+		switch query.Mode {
+		case convai.UQMAll:
+			if !ok {
+				return false
+			}
+		case convai.UQMAny:
+			if ok {
+				return true
+			}
+		case convai.UQMNone:
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return query.Mode != convai.UQMAny || len(query.Checks) == 0
+}
+
+func matchCheck(check convai.QueryCheck, value string, present, channelSearch bool) bool {
+	switch check.Operation {
+	case convai.UQExists:
+		return present
+	case convai.UQNotExists:
+		return !present
+	case convai.UQNotEquals:
+		for _, v := range check.Values {
+			if present && value == v {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !present {
+		return false
+	}
+
+	for _, v := range check.Values {
+		switch check.Operation {
+		case convai.UQEquals:
+			if value == v || (channelSearch && check.Field == "id" && strings.Contains(value, v)) {
+				return true
+			}
+		case convai.UQStartsWith:
+			if strings.HasPrefix(value, v) {
+				return true
+			}
+		case convai.UQGreaterThan:
+			if compareValues(value, v) > 0 {
+				return true
+			}
+		case convai.UQLessThan:
+			if compareValues(value, v) < 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchExecutions returns the executions matching a matcher in the order it asks for, the lock must be held
+func (s *Server) matchExecutions(matcher *convai.ExecutionMatcher) []convai.Execution {
+	filters := append([]convai.ExecutionQueryItem{}, matcher.Filters...)
+	mustNot := append([]convai.ExecutionQueryItem{}, matcher.MustNot...)
+
+	// The item being built is not flushed into Filters or MustNot until the next Where
+	if matcher.CurrentItem != nil {
+		if matcher.NegateCurrent {
+			mustNot = append(mustNot, *matcher.CurrentItem)
+		} else {
+			filters = append(filters, *matcher.CurrentItem)
+		}
+	}
+
+	type doc struct {
+		execution convai.Execution
+		fields    map[string]interface{}
+	}
+
+	matched := []doc{}
+
+Executions:
+	for _, execution := range s.executions {
+		if matcher.EnvID != "" && execution.EnvironmentID.String() != matcher.EnvID {
+			continue
+		}
+
+		fields := executionFields(execution)
+
+		for _, item := range filters {
+			if !matchItem(item, fields) {
+				continue Executions
+			}
+		}
+
+		for _, item := range mustNot {
+			if matchItem(item, fields) {
+				continue Executions
+			}
+		}
+
+		matched = append(matched, doc{execution: execution, fields: fields})
+	}
+
+	sort.SliceStable(matched, func(a, b int) bool {
+		for _, order := range matcher.Sort {
+			va, _ := lookupField(matched[a].fields, order.Field)
+			vb, _ := lookupField(matched[b].fields, order.Field)
+
+			c := compareValues(va, vb)
+			if c == 0 {
+				continue
+			}
+
+			return (c < 0) == order.Ascending
+		}
+
+		return false
+	})
+
+	executions := make([]convai.Execution, 0, len(matched))
+	for _, d := range matched {
+		executions = append(executions, d.execution)
+	}
+
+	return executions
+}
+
+func matchItem(item convai.ExecutionQueryItem, fields map[string]interface{}) bool {
+	value, present := lookupField(fields, item.Field)
+
+	switch item.Op {
+	case convai.EQExists:
+		return present && value != ""
+	case convai.EQEquals:
+		for _, m := range item.Matcher {
+			if present && value == m {
+				return true
+			}
+		}
+	case convai.EQHasPrefix:
+		for _, m := range item.Matcher {
+			if present && strings.HasPrefix(value, m) {
+				return true
+			}
+		}
+	case convai.EQBetweenInclusive, convai.EQBetweenExclusive:
+		if !present || item.LowerBound == nil || item.UpperBound == nil {
+			return false
+		}
+
+		low, high := compareValues(value, *item.LowerBound), compareValues(value, *item.UpperBound)
+		if item.Op == convai.EQBetweenInclusive {
+			return low >= 0 && high <= 0
+		}
+
+		return low > 0 && high < 0
+	}
+
+	return false
+}
+
+// executionFields flattens an execution into its JSON representation so fields can be looked up by their JSON names
+func executionFields(execution convai.Execution) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	data, err := json.Marshal(execution)
+	if err != nil {
+		return fields
+	}
+
+	json.Unmarshal(data, &fields)
+
+	return fields
+}
+
+// lookupField finds a value by a dotted path, rendering it as a string
+func lookupField(data map[string]interface{}, field string) (string, bool) {
+	var current interface{} = data
+
+	for _, part := range strings.Split(field, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		current, ok = m[part]
+		if !ok || current == nil {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data), true
+	}
+
+	return fmt.Sprint(current), true
+}
+
+// compareValues compares two values as times or numbers when both parse as such, and as strings otherwise
+func compareValues(a, b string) int {
+	if ta, err := time.Parse(time.RFC3339Nano, a); err == nil {
+		if tb, err := time.Parse(time.RFC3339Nano, b); err == nil {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+
+			return 0
+		}
+	}
+
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
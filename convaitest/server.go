@@ -0,0 +1,590 @@
+// Package convaitest provides an in memory fake of the Convai API for testing code that uses convai.Client
+package convaitest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultAPIKey is the API key accepted by a server created with NewServer
+const DefaultAPIKey = "convaitest"
+
+// DefaultIdempotencyTTL is how long a server created with NewServer remembers an idempotency key
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// TriggerHandler decides how the fake bot answers a trigger
+// It may modify the session, e.g. to move the stack along
+type TriggerHandler func(req *convai.TriggerRequest, user *convai.ChannelUser, session *convai.Session) (*convai.Response, []convai.ExecError)
+
+// EchoHandler is the default TriggerHandler, it replies with the text it received
+func EchoHandler(req *convai.TriggerRequest, user *convai.ChannelUser, session *convai.Session) (*convai.Response, []convai.ExecError) {
+	if req.Text == "" {
+		return &convai.Response{Messages: []convai.Message{}}, nil
+	}
+
+	text := req.Text
+
+	return &convai.Response{
+		Messages: []convai.Message{
+			{Seq: 0, Message: convai.XMLMessage{Text: &text}},
+		},
+	}, nil
+}
+
+// RecordedRequest is a request received by the server
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// idempotentResult is the response to a mutating request, kept to answer a request repeated with its key
+type idempotentResult struct {
+	body    interface{}
+	res     interface{}
+	expires time.Time
+}
+
+type failure struct {
+	method    string
+	path      string
+	status    int
+	message   string
+	remaining int
+}
+
+// Server is an httptest server implementing every endpoint of the Convai API in memory
+type Server struct {
+	URL           string
+	APIKey        string
+	EnvironmentID uuid.UUID
+
+	srv *httptest.Server
+
+	mu             sync.Mutex
+	superUsers     map[uuid.UUID]*convai.SuperUser
+	channelUsers   map[string]*convai.ChannelUser
+	sessions       map[string]*convai.Session
+	executions     []convai.Execution
+	broadcasts     []convai.BroadcastInput
+	requests       []RecordedRequest
+	idempotent     map[string]idempotentResult
+	idempotencyTTL time.Duration
+	failures       []*failure
+	failureHook    func(r *http.Request) (int, bool)
+	trigger        TriggerHandler
+}
+
+// NewServer starts a server with no data, it must be closed with Close
+func NewServer() *Server {
+	s := &Server{
+		APIKey:         DefaultAPIKey,
+		EnvironmentID:  uuid.NewV4(),
+		superUsers:     make(map[uuid.UUID]*convai.SuperUser),
+		channelUsers:   make(map[string]*convai.ChannelUser),
+		sessions:       make(map[string]*convai.Session),
+		executions:     []convai.Execution{},
+		broadcasts:     []convai.BroadcastInput{},
+		requests:       []RecordedRequest{},
+		idempotent:     make(map[string]idempotentResult),
+		idempotencyTTL: DefaultIdempotencyTTL,
+		trigger:        EchoHandler,
+	}
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client that talks to the server, opts are applied after the server's URL and key
+func (s *Server) Client(opts ...convai.Option) *convai.Client {
+	return convai.NewClient(s.APIKey, append([]convai.Option{convai.WithBaseURL(s.URL)}, opts...)...)
+}
+
+// SetTriggerHandler replaces the fake bot used by trigger and broadcast
+func (s *Server) SetTriggerHandler(handler TriggerHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trigger = handler
+}
+
+// SetIdempotencyTTL changes how long idempotency keys are remembered, a request repeated after that is performed again
+func (s *Server) SetIdempotencyTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idempotencyTTL = ttl
+}
+
+// FailNext makes the next times requests matching method and path fail with status
+// The path matches exactly, or as a prefix when it ends with *. An empty method matches any method
+func (s *Server) FailNext(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		method:    method,
+		path:      path,
+		status:    status,
+		message:   http.StatusText(status),
+		remaining: times,
+	})
+}
+
+// SetFailureHook installs a function that can fail any request, returning the status to respond with and true
+// The hook is called without holding the server's lock, so it may call the server's other methods
+func (s *Server) SetFailureHook(hook func(r *http.Request) (status int, fail bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failureHook = hook
+}
+
+// Requests returns every request received so far
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]RecordedRequest{}, s.requests...)
+}
+
+// AddUser stores a super user and its channel users as they are, generating an ID when it has none
+func (s *Server) AddUser(user convai.SuperUser) convai.SuperUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uuid.Equal(user.ID, uuid.Nil) {
+		user.ID = uuid.NewV4()
+	}
+
+	if uuid.Equal(user.EnvironmentID, uuid.Nil) {
+		user.EnvironmentID = s.EnvironmentID
+	}
+
+	if user.Data == nil {
+		user.Data = make(map[string]interface{})
+	}
+
+	if user.CreatedAt == nil {
+		now := time.Now().UTC()
+		user.CreatedAt = &now
+		user.UpdatedAt = &now
+	}
+
+	for _, cu := range user.ChannelUsers {
+		cu := cu
+		cu.SuperUserID = user.ID
+		cu.EnvironmentID = user.EnvironmentID
+
+		if cu.Session != nil {
+			s.sessions[cu.ChannelId] = cu.Session
+			cu.Session = nil
+		}
+
+		s.channelUsers[cu.ChannelId] = &cu
+	}
+
+	user.ChannelUsers = nil
+	s.superUsers[user.ID] = &user
+
+	return *s.superUserView(&user)
+}
+
+// AddExecution stores an execution, generating an ID and start time when it has none
+func (s *Server) AddExecution(execution convai.Execution) convai.Execution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uuid.Equal(execution.ID, uuid.Nil) {
+		execution.ID = uuid.NewV4()
+	}
+
+	if execution.StartTime.IsZero() {
+		execution.StartTime = time.Now().UTC()
+	}
+
+	s.executions = append(s.executions, execution)
+
+	return execution
+}
+
+// SuperUser returns a stored super user along with its channel users and their sessions
+func (s *Server) SuperUser(id uuid.UUID) (convai.SuperUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.superUsers[id]
+	if !ok {
+		return convai.SuperUser{}, false
+	}
+
+	return *s.superUserView(user), true
+}
+
+// SuperUsers returns every stored super user, oldest first
+func (s *Server) SuperUsers() []convai.SuperUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []convai.SuperUser{}
+	for _, user := range s.sortedSuperUsers() {
+		users = append(users, *s.superUserView(user))
+	}
+
+	return users
+}
+
+// ChannelUser returns a stored channel user with its session
+func (s *Server) ChannelUser(id string) (convai.ChannelUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cu, ok := s.channelUsers[id]
+	if !ok {
+		return convai.ChannelUser{}, false
+	}
+
+	return s.channelUserView(cu), true
+}
+
+// Session returns the stored session of a channel user
+func (s *Server) Session(channelUserID string) (convai.Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[channelUserID]
+	if !ok {
+		return convai.Session{}, false
+	}
+
+	return *session, true
+}
+
+// Executions returns every stored execution in the order they were created
+func (s *Server) Executions() []convai.Execution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]convai.Execution{}, s.executions...)
+}
+
+// Broadcasts returns the input of every broadcast received
+func (s *Server) Broadcasts() []convai.BroadcastInput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]convai.BroadcastInput{}, s.broadcasts...)
+}
+
+// superUserView assembles a super user with its channel users, the lock must be held
+func (s *Server) superUserView(user *convai.SuperUser) *convai.SuperUser {
+	view := *user
+	view.Data = copyMap(user.Data)
+	view.ChannelUsers = []convai.ChannelUser{}
+
+	for _, cu := range s.sortedChannelUsers() {
+		if uuid.Equal(cu.SuperUserID, user.ID) {
+			view.ChannelUsers = append(view.ChannelUsers, s.channelUserView(cu))
+		}
+	}
+
+	return &view
+}
+
+// channelUserView attaches a copy of the channel user's session, the lock must be held
+func (s *Server) channelUserView(cu *convai.ChannelUser) convai.ChannelUser {
+	view := *cu
+	view.Data = copyMap(cu.Data)
+
+	if session, ok := s.sessions[cu.ChannelId]; ok {
+		copied := *session
+		view.Session = &copied
+	}
+
+	return view
+}
+
+func (s *Server) sortedSuperUsers() []*convai.SuperUser {
+	users := make([]*convai.SuperUser, 0, len(s.superUsers))
+	for _, user := range s.superUsers {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(a, b int) bool {
+		ta, tb := users[a].CreatedAt, users[b].CreatedAt
+		if ta != nil && tb != nil && !ta.Equal(*tb) {
+			return ta.Before(*tb)
+		}
+
+		return users[a].ID.String() < users[b].ID.String()
+	})
+
+	return users
+}
+
+func (s *Server) sortedChannelUsers() []*convai.ChannelUser {
+	users := make([]*convai.ChannelUser, 0, len(s.channelUsers))
+	for _, cu := range s.channelUsers {
+		users = append(users, cu)
+	}
+
+	sort.Slice(users, func(a, b int) bool {
+		return users[a].ChannelId < users[b].ChannelId
+	})
+
+	return users
+}
+
+// request carries a decoded incoming request through the handlers
+type request struct {
+	*http.Request
+	body  []byte
+	codec convai.Codec
+}
+
+func (r *request) decode(v interface{}) error {
+	return r.codec.Unmarshal(r.body, v)
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func errorf(status int, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		s.respondError(w, r, errorf(http.StatusBadRequest, "reading body: %s", err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	authorized := r.Header.Get("Authorization") == "Bearer "+s.APIKey
+	hook := s.failureHook
+	s.mu.Unlock()
+
+	if !authorized {
+		s.respondError(w, r, errorf(http.StatusUnauthorized, "invalid API key"))
+		return
+	}
+
+	// The hook runs without the lock, so it may inspect the server
+	if hook != nil {
+		if status, fail := hook(r); fail {
+			s.respondError(w, r, errorf(status, http.StatusText(status)))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, fail := s.injectedFailure(r); fail {
+		s.respondError(w, r, errorf(status, http.StatusText(status)))
+		return
+	}
+
+	req := &request{Request: r, body: body, codec: codecFor(r.Header.Get("Content-Type"))}
+
+	// A repeated mutating request is answered with the response to the first one, like the real API
+	// Reusing a key for a different request is refused, and keys are forgotten once they expire
+	key := r.Header.Get(convai.IdempotencyKeyHeader)
+	var sent interface{}
+	if key != "" {
+		key = r.URL.Path + ":" + key
+		req.decode(&sent)
+
+		if stored, ok := s.idempotent[key]; ok && time.Now().Before(stored.expires) {
+			if !reflect.DeepEqual(stored.body, sent) {
+				s.respondError(w, r, errorf(http.StatusUnprocessableEntity, "idempotency key %q was used for a different request", r.Header.Get(convai.IdempotencyKeyHeader)))
+				return
+			}
+
+			s.respond(w, r, http.StatusOK, stored.res)
+			return
+		}
+
+		delete(s.idempotent, key)
+	}
+
+	res, apiErr := s.route(req)
+	if apiErr != nil {
+		s.respondError(w, r, apiErr)
+		return
+	}
+
+	if key != "" {
+		s.idempotent[key] = idempotentResult{body: sent, res: res, expires: time.Now().Add(s.idempotencyTTL)}
+	}
+
+	s.respond(w, r, http.StatusOK, res)
+}
+
+func (s *Server) route(r *request) (interface{}, *apiError) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case r.Method == http.MethodPost && path == "/users/super/create":
+		return s.createSuperUser(r)
+	case r.Method == http.MethodPost && path == "/users/channel/create":
+		return s.createChannelUsers(r)
+	case r.Method == http.MethodPost && path == "/users/super/query":
+		return s.queryUsers(r)
+	case r.Method == http.MethodPost && path == "/users/super/query/reachable":
+		return s.queryUsersReachable(r)
+	case r.Method == http.MethodPost && path == "/users/super/merge":
+		return s.mergeUsers(r)
+	case strings.HasPrefix(path, "/users/super/"):
+		return s.superUser(r, strings.TrimPrefix(path, "/users/super/"))
+	case strings.HasPrefix(path, "/users/channel/"):
+		return s.channelUser(r, strings.TrimPrefix(path, "/users/channel/"))
+	case strings.HasPrefix(path, "/users/session/"):
+		return s.session(r, strings.TrimPrefix(path, "/users/session/"))
+	case r.Method == http.MethodPost && path == "/executions/query":
+		return s.queryExecutions(r)
+	case r.Method == http.MethodPost && path == "/executions/trigger":
+		return s.triggerExecution(r)
+	case r.Method == http.MethodPost && path == "/executions/broadcast":
+		return s.broadcast(r)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/executions/"):
+		return s.getExecution(strings.TrimPrefix(path, "/executions/"))
+	}
+
+	return nil, errorf(http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+}
+
+// injectedFailure checks the failures set up with FailNext, the lock must be held
+func (s *Server) injectedFailure(r *http.Request) (int, bool) {
+	for i, f := range s.failures {
+		if f.method != "" && f.method != r.Method {
+			continue
+		}
+
+		matches := f.path == r.URL.Path
+		if strings.HasSuffix(f.path, "*") {
+			matches = strings.HasPrefix(r.URL.Path, strings.TrimSuffix(f.path, "*"))
+		}
+
+		if !matches {
+			continue
+		}
+
+		f.remaining--
+		if f.remaining <= 0 {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+		}
+
+		return f.status, true
+	}
+
+	return 0, false
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	codec := responseCodec(r.Header.Get("Accept"))
+
+	data, err := codec.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Header().Set("X-Request-Id", uuid.NewV4().String())
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *Server) respondError(w http.ResponseWriter, r *http.Request, apiErr *apiError) {
+	s.respond(w, r, apiErr.status, convai.APIError{Code: apiErr.status, Message: apiErr.message})
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.ReadAll(zr)
+	}
+
+	return body, nil
+}
+
+func codecFor(contentType string) convai.Codec {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == convai.MsgpackCodec.ContentType() || mediaType == "application/x-msgpack" {
+		return convai.MsgpackCodec
+	}
+
+	return convai.JSONCodec
+}
+
+// responseCodec uses the first media type the client accepts that the server speaks
+func responseCodec(accept string) convai.Codec {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case convai.MsgpackCodec.ContentType(), "application/x-msgpack":
+			return convai.MsgpackCodec
+		case convai.JSONCodec.ContentType():
+			return convai.JSONCodec
+		}
+	}
+
+	return convai.JSONCodec
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,345 @@
+package convaitest
+
+import (
+	"net/http"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (s *Server) createSuperUser(r *request) (interface{}, *apiError) {
+	var req convai.CreateCombinedUserRequest
+	if err := r.decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+	}
+
+	envID := req.EnvironmentID
+	if uuid.Equal(envID, uuid.Nil) {
+		envID = s.EnvironmentID
+	}
+
+	if apiErr := s.checkNewChannelUsers(req.ChannelUsers); apiErr != nil {
+		return nil, apiErr
+	}
+
+	now := time.Now().UTC()
+
+	user := &convai.SuperUser{
+		ID:            uuid.NewV4(),
+		EnvironmentID: envID,
+		Data:          copyMap(req.UserData),
+		CreatedAt:     &now,
+		UpdatedAt:     &now,
+	}
+
+	if user.Data == nil {
+		user.Data = make(map[string]interface{})
+	}
+
+	s.superUsers[user.ID] = user
+
+	return &convai.CreateCombinedUserResult{
+		SuperUserID:    user.ID,
+		ChannelUserIDs: s.addChannelUsers(user, req.ChannelUsers),
+	}, nil
+}
+
+func (s *Server) createChannelUsers(r *request) (interface{}, *apiError) {
+	var req convai.CreateChannelUsersRequest
+	if err := r.decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+	}
+
+	user, ok := s.superUsers[req.SuperUserID]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "super user %s not found", req.SuperUserID)
+	}
+
+	if apiErr := s.checkNewChannelUsers(req.ChannelUsers); apiErr != nil {
+		return nil, apiErr
+	}
+
+	return &convai.CreateChannelUsersResult{
+		ChannelUserIDs: s.addChannelUsers(user, req.ChannelUsers),
+	}, nil
+}
+
+// checkNewChannelUsers rejects channel user IDs that are taken or repeated
+func (s *Server) checkNewChannelUsers(users []convai.CreateChannelUser) *apiError {
+	seen := make(map[string]bool)
+
+	for _, cu := range users {
+		if cu.ChannelID == "" {
+			return errorf(http.StatusBadRequest, "channel user is missing a channel id")
+		}
+
+		if _, ok := s.channelUsers[cu.ChannelID]; ok || seen[cu.ChannelID] {
+			return errorf(http.StatusConflict, "channel user %s already exists", cu.ChannelID)
+		}
+
+		seen[cu.ChannelID] = true
+	}
+
+	return nil
+}
+
+func (s *Server) addChannelUsers(user *convai.SuperUser, users []convai.CreateChannelUser) []string {
+	now := time.Now().UTC()
+	ids := []string{}
+
+	for _, cu := range users {
+		s.channelUsers[cu.ChannelID] = &convai.ChannelUser{
+			ChannelId:     cu.ChannelID,
+			EnvironmentID: user.EnvironmentID,
+			Channel:       cu.Channel,
+			Data:          make(map[string]interface{}),
+			SuperUserID:   user.ID,
+			CreatedAt:     &now,
+			UpdatedAt:     &now,
+		}
+
+		session := cu.Session
+		if session == nil {
+			session = newSession()
+		}
+
+		s.sessions[cu.ChannelID] = session
+		ids = append(ids, cu.ChannelID)
+	}
+
+	return ids
+}
+
+func newSession() *convai.Session {
+	return &convai.Session{
+		Flaggable: convai.NewFlaggable(nil),
+		Stack:     convai.Stack{Frames: []convai.Frame{{}}},
+		ID:        uuid.NewV4(),
+	}
+}
+
+func (s *Server) queryUsers(r *request) (interface{}, *apiError) {
+	var query convai.UserQuery
+	if err := r.decode(&query); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid query: %s", err.Error())
+	}
+
+	matched := s.matchUsers(&query)
+
+	res := &convai.UserQueryResult{
+		Users: []convai.SuperUser{},
+		Count: uint64(len(matched)),
+	}
+
+	for _, user := range page(len(matched), query.Offset, query.Limit) {
+		res.Users = append(res.Users, *s.superUserView(matched[user]))
+	}
+
+	return res, nil
+}
+
+// queryUsersReachable counts the matched users that have at least one channel user
+func (s *Server) queryUsersReachable(r *request) (interface{}, *apiError) {
+	var query convai.UserQuery
+	if err := r.decode(&query); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid query: %s", err.Error())
+	}
+
+	var count uint64
+	for _, user := range s.matchUsers(&query) {
+		if len(s.superUserView(user).ChannelUsers) > 0 {
+			count++
+		}
+	}
+
+	return &convai.ReachableUserResult{Count: count}, nil
+}
+
+// mergeUsers folds every user into the oldest one
+// Data the oldest user already has is kept, unless the field is in PreferNewUserFields, then the newest value wins
+func (s *Server) mergeUsers(r *request) (interface{}, *apiError) {
+	var req convai.MergeUsersRequest
+	if err := r.decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+	}
+
+	if len(req.SuperUserIDs) < 2 {
+		return nil, errorf(http.StatusBadRequest, "at least two super users are needed for a merge")
+	}
+
+	var users []*convai.SuperUser
+	seen := make(map[uuid.UUID]bool)
+
+	for _, user := range s.sortedSuperUsers() {
+		for _, want := range req.SuperUserIDs {
+			if uuid.Equal(user.ID, want) && !seen[want] {
+				users = append(users, user)
+				seen[want] = true
+			}
+		}
+	}
+
+	for _, id := range req.SuperUserIDs {
+		if !seen[id] {
+			return nil, errorf(http.StatusNotFound, "super user %s not found", id)
+		}
+	}
+
+	preferNew := make(map[string]bool)
+	for _, field := range req.PreferNewUserFields {
+		preferNew[field] = true
+	}
+
+	target := users[0]
+
+	for _, user := range users[1:] {
+		for k, v := range user.Data {
+			if _, ok := target.Data[k]; !ok || preferNew[k] {
+				target.Data[k] = v
+			}
+		}
+
+		for _, cu := range s.channelUsers {
+			if uuid.Equal(cu.SuperUserID, user.ID) {
+				cu.SuperUserID = target.ID
+			}
+		}
+
+		delete(s.superUsers, user.ID)
+	}
+
+	now := time.Now().UTC()
+	target.UpdatedAt = &now
+
+	return s.superUserView(target), nil
+}
+
+func (s *Server) superUser(r *request, id string) (interface{}, *apiError) {
+	userID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid super user id %q", id)
+	}
+
+	user, ok := s.superUsers[userID]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "super user %s not found", id)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return s.superUserView(user), nil
+	case http.MethodDelete:
+		view := s.superUserView(user)
+		delete(s.superUsers, userID)
+
+		// Like the real API, the user's channel users and their sessions go with it
+		for id, cu := range s.channelUsers {
+			if uuid.Equal(cu.SuperUserID, userID) {
+				delete(s.channelUsers, id)
+				delete(s.sessions, id)
+			}
+		}
+
+		return view, nil
+	case http.MethodPut:
+		var input convai.UpdateUserDataInput
+		if err := r.decode(&input); err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+		}
+
+		applyUpdate(user.Data, &input)
+
+		now := time.Now().UTC()
+		user.UpdatedAt = &now
+
+		return s.superUserView(user), nil
+	}
+
+	return nil, errorf(http.StatusMethodNotAllowed, "%s not allowed on super users", r.Method)
+}
+
+func (s *Server) channelUser(r *request, id string) (interface{}, *apiError) {
+	cu, ok := s.channelUsers[id]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "channel user %s not found", id)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		view := s.channelUserView(cu)
+		return &view, nil
+	case http.MethodDelete:
+		view := s.channelUserView(cu)
+		delete(s.channelUsers, id)
+		delete(s.sessions, id)
+		return &view, nil
+	}
+
+	return nil, errorf(http.StatusMethodNotAllowed, "%s not allowed on channel users", r.Method)
+}
+
+// session serves the session of a channel user, deleting it resets the channel user to a fresh session
+func (s *Server) session(r *request, id string) (interface{}, *apiError) {
+	if _, ok := s.channelUsers[id]; !ok {
+		return nil, errorf(http.StatusNotFound, "channel user %s not found", id)
+	}
+
+	session, ok := s.sessions[id]
+	if !ok {
+		session = newSession()
+		s.sessions[id] = session
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return session, nil
+	case http.MethodDelete:
+		s.sessions[id] = newSession()
+		return session, nil
+	case http.MethodPut:
+		var input convai.UpdateUserDataInput
+		if err := r.decode(&input); err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid request: %s", err.Error())
+		}
+
+		if session.FData == nil {
+			session.FData = make(map[string]interface{})
+		}
+
+		applyUpdate(session.FData, &input)
+
+		return session, nil
+	}
+
+	return nil, errorf(http.StatusMethodNotAllowed, "%s not allowed on sessions", r.Method)
+}
+
+func applyUpdate(data map[string]interface{}, input *convai.UpdateUserDataInput) {
+	for k, v := range input.Set {
+		data[k] = v
+	}
+
+	for _, k := range input.Delete {
+		delete(data, k)
+	}
+}
+
+// page returns the indexes of the items in a page of a result set of size n
+func page(n, offset, limit int) []int {
+	if offset < 0 {
+		offset = 0
+	}
+
+	end := n
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	indexes := []int{}
+	for i := offset; i < end; i++ {
+		indexes = append(indexes, i)
+	}
+
+	return indexes
+}
@@ -0,0 +1,94 @@
+package convai_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+func TestFakeBroadcastPagesUsers(t *testing.T) {
+	srv := newAudience(3)
+	defer srv.Close()
+
+	res, err := srv.Client().BroadcastWithContext(context.Background(), &convai.BroadcastInput{
+		Channel:   "sms",
+		UserQuery: convai.UserQuery{Offset: 1, Limit: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Users != 1 {
+		t.Fatalf("expected 1 user to be reached, got %d", res.Users)
+	}
+
+	if n := len(srv.Executions()); n != 1 {
+		t.Fatalf("expected 1 execution, got %d", n)
+	}
+}
+
+func TestFailureHookMayInspectServer(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.SetFailureHook(func(r *http.Request) (int, bool) {
+		return http.StatusServiceUnavailable, len(srv.Requests()) == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := srv.Client(convai.WithRetryPolicy(fastRetries))
+
+	if _, err := client.QueryUsersWithContext(ctx, &convai.UserQuery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(srv.Requests()); n != 2 {
+		t.Fatalf("expected the first attempt to fail and the second to succeed, got %d requests", n)
+	}
+}
+
+func TestFakeTriggerHandlerMayInspectServer(t *testing.T) {
+	srv := newAudience(1)
+	defer srv.Close()
+
+	srv.SetTriggerHandler(func(req *convai.TriggerRequest, user *convai.ChannelUser, session *convai.Session) (*convai.Response, []convai.ExecError) {
+		if _, ok := srv.ChannelUser(user.ChannelId); !ok {
+			t.Errorf("expected the handler to find %s", user.ChannelId)
+		}
+
+		session.FData["seen"] = true
+
+		return &convai.Response{Messages: []convai.Message{}}, nil
+	})
+
+	if _, err := srv.Client().TriggerWithContext(context.Background(), &convai.TriggerRequest{ChannelID: "cu0", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if session, _ := srv.Session("cu0"); session.FData["seen"] != true {
+		t.Fatalf("expected the handler's change to the session to be kept, got %v", session.FData)
+	}
+}
+
+func TestFakeDeletesChannelUsersWithSuperUser(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	user := srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}, {ChannelId: "cu2", Channel: "web"}}})
+
+	if _, err := srv.Client().DeleteSuperUserWithContext(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"cu1", "cu2"} {
+		if _, ok := srv.ChannelUser(id); ok {
+			t.Fatalf("expected %s to be deleted with its super user", id)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package convai
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ExecutionError is returned by Reply.Err when the bot reported errors while handling a turn
+type ExecutionError struct {
+	Errors []ExecError
+}
+
+func (e *ExecutionError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Message)
+	}
+
+	return fmt.Sprintf("execution failed with %d errors: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Reply is the bot's answer to a single turn of a conversation
+type Reply struct {
+	Execution *Execution
+
+	// Messages are the outgoing messages ordered by their sequence number
+	Messages []XMLMessage
+
+	// Batches groups the messages the way they should be delivered. A message marked ShouldBatch
+	// is delivered together with the messages following it
+	Batches [][]XMLMessage
+
+	Errors []ExecError
+}
+
+// NewReply builds the reply of an execution, e.g. one returned by QueryExecutions
+func NewReply(execution *Execution) *Reply {
+	reply := &Reply{
+		Execution: execution,
+		Messages:  []XMLMessage{},
+		Batches:   [][]XMLMessage{},
+		Errors:    execution.Errors,
+	}
+
+	if execution.Response == nil {
+		return reply
+	}
+
+	messages := append([]Message{}, execution.Response.Messages...)
+	sort.SliceStable(messages, func(a, b int) bool {
+		return messages[a].Seq < messages[b].Seq
+	})
+
+	var batch []XMLMessage
+	for _, m := range messages {
+		reply.Messages = append(reply.Messages, m.Message)
+		batch = append(batch, m.Message)
+
+		if !m.ShouldBatch {
+			reply.Batches = append(reply.Batches, batch)
+			batch = nil
+		}
+	}
+
+	if len(batch) > 0 {
+		reply.Batches = append(reply.Batches, batch)
+	}
+
+	return reply
+}
+
+// Text joins the text of every message, one per line
+func (r *Reply) Text() string {
+	var lines []string
+	for _, m := range r.Messages {
+		if m.Text != nil {
+			lines = append(lines, *m.Text)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// QuickReplies returns the quick replies offered by the last message that has any
+func (r *Reply) QuickReplies() []XMLQR {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if len(r.Messages[i].QuickReplies) > 0 {
+			return r.Messages[i].QuickReplies
+		}
+	}
+
+	return nil
+}
+
+// Err returns an ExecutionError when the bot reported errors, and nil otherwise
+func (r *Reply) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	return &ExecutionError{Errors: r.Errors}
+}
+
+// Conversation talks to the bot as a single channel user, keeping the replies of every turn
+// It is safe for concurrent use, turns are sent one at a time
+type Conversation struct {
+	client        *Client
+	channelUserID string
+
+	mu      sync.Mutex
+	history []*Reply
+
+	// turns counts every turn sent, including failed ones, so a turn that is sent again gets a new key
+	turns int
+}
+
+// Converse returns a conversation handle for a channel user
+func (c *Client) Converse(channelUserID string) *Conversation {
+	return &Conversation{
+		client:        c,
+		channelUserID: channelUserID,
+		history:       []*Reply{},
+	}
+}
+
+// Say sends a single message as a channel user and returns the bot's reply
+// A key set on ctx with WithIdempotencyKey is sent as it is, so every message needs a key of its own.
+// Use a Conversation to derive a key per turn instead
+func (c *Client) Say(ctx context.Context, channelUserID, text string) (*Reply, error) {
+	execution, err := c.TriggerWithContext(ctx, &TriggerRequest{ChannelID: channelUserID, Text: text})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReply(execution), nil
+}
+
+// ChannelUserID returns the channel user the conversation is held as
+func (cv *Conversation) ChannelUserID() string {
+	return cv.channelUserID
+}
+
+// Start begins the conversation from the start of the bot's flow
+func (cv *Conversation) Start(ctx context.Context) (*Reply, error) {
+	return cv.Send(ctx, &TriggerRequest{IsStart: true})
+}
+
+// Say sends text and returns the bot's reply
+func (cv *Conversation) Say(ctx context.Context, text string) (*Reply, error) {
+	return cv.Send(ctx, &TriggerRequest{Text: text})
+}
+
+// Send triggers the bot with req as the conversation's channel user, whose ChannelID is filled in
+func (cv *Conversation) Send(ctx context.Context, req *TriggerRequest) (*Reply, error) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+
+	r := *req
+	r.ChannelID = cv.channelUserID
+
+	// Each turn is a separate message, so it must not be deduplicated against the previous one
+	ctx = deriveIdempotencyKey(ctx, fmt.Sprintf("turn-%d", cv.turns))
+	cv.turns++
+
+	execution, err := cv.client.TriggerWithContext(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := NewReply(execution)
+	cv.history = append(cv.history, reply)
+
+	return reply, nil
+}
+
+// History returns the replies of every turn so far, oldest first
+func (cv *Conversation) History() []*Reply {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+
+	return append([]*Reply{}, cv.history...)
+}
+
+// Last returns the reply to the most recent turn, or nil before the first one
+func (cv *Conversation) Last() *Reply {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+
+	if len(cv.history) == 0 {
+		return nil
+	}
+
+	return cv.history[len(cv.history)-1]
+}
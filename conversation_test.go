@@ -0,0 +1,82 @@
+package convai_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+func TestNewReplyOrdersMessagesBySequence(t *testing.T) {
+	text := func(s string) convai.XMLMessage { return convai.XMLMessage{Text: &s} }
+
+	reply := convai.NewReply(&convai.Execution{Response: &convai.Response{Messages: []convai.Message{
+		{Seq: 3, Message: text("c")},
+		{Seq: 1, Message: text("a"), ShouldBatch: true},
+		{Seq: 4, Message: text("d"), ShouldBatch: true},
+		{Seq: 2, Message: text("b")},
+	}}})
+
+	if got := reply.Text(); got != "a\nb\nc\nd" {
+		t.Fatalf("expected the messages in sequence order, got %q", got)
+	}
+
+	// a is batched with b, c stands alone and d is batched with nothing as it is the last message
+	want := []string{"a b", "c", "d"}
+	if len(reply.Batches) != len(want) {
+		t.Fatalf("expected batches %v, got %d batches", want, len(reply.Batches))
+	}
+
+	for i, batch := range reply.Batches {
+		var texts []string
+		for _, m := range batch {
+			texts = append(texts, *m.Text)
+		}
+
+		if got := strings.Join(texts, " "); got != want[i] {
+			t.Fatalf("expected batch %d to be %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestNewReplyWithoutResponse(t *testing.T) {
+	reply := convai.NewReply(&convai.Execution{})
+
+	if len(reply.Messages) != 0 || len(reply.Batches) != 0 || reply.Text() != "" || reply.Err() != nil {
+		t.Fatalf("expected an empty reply, got %+v", reply)
+	}
+}
+
+func TestConversationGivesEveryAttemptItsOwnKey(t *testing.T) {
+	srv := newAudience(1)
+	defer srv.Close()
+
+	srv.FailNext("POST", "/executions/trigger", 400, 1)
+
+	ctx := convai.WithIdempotencyKey(context.Background(), "chat")
+	cv := srv.Client().Converse("cu0")
+
+	if _, err := cv.Say(ctx, "hi"); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+
+	if _, err := cv.Say(ctx, "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := srv.Client().Say(ctx, "cu0", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, r := range srv.Requests() {
+		if r.Path == "/executions/trigger" {
+			keys = append(keys, r.Header.Get(convai.IdempotencyKeyHeader))
+		}
+	}
+
+	if strings.Join(keys, " ") != "chat-turn-0 chat-turn-1 chat" {
+		t.Fatalf("expected a key per attempt and the caller's key for Say, got %v", keys)
+	}
+}
@@ -0,0 +1,148 @@
+package convai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Sentinel errors that API errors can be matched against with errors.Is
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServerError  = errors.New("server error")
+)
+
+// maxBodySnippet is the maximum number of response body bytes kept on an error
+const maxBodySnippet = 512
+
+// APIError is returned when the API responds with a non 2xx status
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// StatusCode is the HTTP status of the response, Code is the error code reported in its body
+	StatusCode int    `json:"-"`
+	RequestID  string `json:"-"`
+	Body       string `json:"-"`
+
+	// Attempts is the number of requests made before the error was returned
+	Attempts int `json:"-"`
+}
+
+func (a *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", a.Code, a.Message)
+}
+
+// Is allows matching an APIError against the sentinel errors based on its HTTP status
+func (a *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return a.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return a.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return a.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return a.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return a.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return a.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return a.StatusCode >= 500
+	}
+
+	return false
+}
+
+// TransportError is returned when a request could not be sent or its response could not be read
+type TransportError struct {
+	Method string
+	Path   string
+	Err    error
+}
+
+func (t *TransportError) Error() string {
+	// Errors from http.Client already describe the method and URL
+	return t.Err.Error()
+}
+
+func (t *TransportError) Unwrap() error {
+	return t.Err
+}
+
+// EncodeError is returned when a request body could not be encoded, the request is not sent
+type EncodeError struct {
+	Method string
+	Path   string
+	Err    error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("encoding %s %s request: %s", e.Method, e.Path, e.Err.Error())
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when a successful response body could not be decoded
+type DecodeError struct {
+	StatusCode int
+	RequestID  string
+	Body       string
+	Err        error
+}
+
+func (d *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %d response: %s", d.StatusCode, d.Err.Error())
+}
+
+func (d *DecodeError) Unwrap() error {
+	return d.Err
+}
+
+// IsNotFound reports whether err was caused by the API responding with 404
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsRateLimited reports whether err was caused by the API responding with 429
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// StatusCode returns the HTTP status of the response that caused err, or 0 if there was none
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.StatusCode
+	}
+
+	return 0
+}
+
+// bodySnippet truncates a response body so it can be attached to an error
+func bodySnippet(body []byte) string {
+	if len(body) <= maxBodySnippet {
+		return string(body)
+	}
+
+	snippet := body[:maxBodySnippet]
+	for len(snippet) > 0 && !utf8.Valid(snippet) {
+		snippet = snippet[:len(snippet)-1]
+	}
+
+	return string(snippet) + "..."
+}
@@ -0,0 +1,303 @@
+package convai
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	ForgetKindSession     = "session"
+	ForgetKindChannelUser = "channel_user"
+	ForgetKindSuperUser   = "super_user"
+)
+
+const (
+	ForgetStatusDeleted     = "deleted"
+	ForgetStatusWouldDelete = "would_delete"
+	ForgetStatusNotFound    = "not_found"
+	ForgetStatusFailed      = "failed"
+	ForgetStatusSkipped     = "skipped"
+)
+
+// ErrForgetIncomplete is returned when some of a user's records could not be removed
+// Running ForgetUser again resumes the erasure, records that are already gone are reported as not found
+var ErrForgetIncomplete = errors.New("user was not completely forgotten")
+
+// ForgetOptions configures ForgetUser
+type ForgetOptions struct {
+	// DryRun reports what would be removed without deleting anything
+	DryRun bool
+
+	// MaxAttempts is the number of times each deletion is tried before giving up, defaults to 3
+	// Only transport errors, 429 and 5xx responses are retried, other failures are reported straight away
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry of a deletion, it doubles on every further retry. Defaults to 500ms
+	Backoff time.Duration
+
+	// SigningKey, when set, is used to sign the report with HMAC-SHA256 so it can be kept as proof of erasure
+	SigningKey []byte
+}
+
+// ForgetAction records what happened to a single record during an erasure
+type ForgetAction struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ForgetReport lists everything that was removed for a user, in the order it was removed
+type ForgetReport struct {
+	SuperUserID uuid.UUID      `json:"superUserId"`
+	DryRun      bool           `json:"dryRun"`
+	Complete    bool           `json:"complete"`
+	StartedAt   time.Time      `json:"startedAt"`
+	CompletedAt time.Time      `json:"completedAt"`
+	Actions     []ForgetAction `json:"actions"`
+
+	// Signature is the hex encoded HMAC-SHA256 of the report without its signature
+	Signature string `json:"signature,omitempty"`
+}
+
+// ForgetUser erases a super user and everything attached to it: the session of each channel user,
+// the channel users themselves and finally the super user
+// A channel user is only deleted once its session is gone, and the super user once all of its channel users are gone,
+// so a partial failure never leaves orphans behind. In that case the report is returned along with ErrForgetIncomplete
+func (c *Client) ForgetUser(ctx context.Context, superUserID uuid.UUID, opts *ForgetOptions) (*ForgetReport, error) {
+	if opts == nil {
+		opts = &ForgetOptions{}
+	}
+
+	report := &ForgetReport{
+		SuperUserID: superUserID,
+		DryRun:      opts.DryRun,
+		StartedAt:   time.Now().UTC(),
+		Actions:     []ForgetAction{},
+	}
+
+	user, err := c.GetSuperUserWithContext(ctx, superUserID)
+	if IsNotFound(err) {
+		report.Actions = append(report.Actions, ForgetAction{
+			Kind:   ForgetKindSuperUser,
+			ID:     superUserID.String(),
+			Status: ForgetStatusNotFound,
+		})
+		report.Complete = true
+		return c.finishForget(report, opts)
+	} else if err != nil {
+		return nil, err
+	}
+
+	remaining := 0
+	for _, cu := range user.ChannelUsers {
+		id := cu.ChannelId
+
+		session := c.forgetStep(ctx, opts, ForgetKindSession, id, func() error {
+			_, err := c.DeleteSessionWithContext(ctx, id)
+			return err
+		})
+		report.Actions = append(report.Actions, session)
+
+		// Deleting the channel user would leave its session behind with nothing pointing at it
+		if session.Status == ForgetStatusFailed {
+			report.Actions = append(report.Actions, ForgetAction{
+				Kind:   ForgetKindChannelUser,
+				ID:     id,
+				Status: ForgetStatusSkipped,
+				Error:  "session could not be deleted",
+			})
+			remaining++
+			continue
+		}
+
+		channelUser := c.forgetStep(ctx, opts, ForgetKindChannelUser, id, func() error {
+			_, err := c.DeleteChannelUserWithContext(ctx, id)
+			return err
+		})
+		report.Actions = append(report.Actions, channelUser)
+
+		if channelUser.Status == ForgetStatusFailed {
+			remaining++
+		}
+	}
+
+	if remaining > 0 {
+		report.Actions = append(report.Actions, ForgetAction{
+			Kind:   ForgetKindSuperUser,
+			ID:     superUserID.String(),
+			Status: ForgetStatusSkipped,
+			Error:  fmt.Sprintf("%d channel users could not be deleted", remaining),
+		})
+	} else {
+		report.Actions = append(report.Actions, c.forgetStep(ctx, opts, ForgetKindSuperUser, superUserID.String(), func() error {
+			_, err := c.DeleteSuperUserWithContext(ctx, superUserID)
+			return err
+		}))
+	}
+
+	report.Complete = true
+	for _, action := range report.Actions {
+		if action.Status == ForgetStatusFailed || action.Status == ForgetStatusSkipped {
+			report.Complete = false
+		}
+	}
+
+	report, err = c.finishForget(report, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.Complete {
+		return report, ErrForgetIncomplete
+	}
+
+	return report, nil
+}
+
+// ForgetUsers erases every super user matched by query, stopping at the first error other than ErrForgetIncomplete
+func (c *Client) ForgetUsers(ctx context.Context, query *UserQuery, opts *ForgetOptions) ([]*ForgetReport, error) {
+	// Collect the IDs first, deleting while paginating would shift the offsets
+	var ids []uuid.UUID
+
+	it := c.IterateUsers(ctx, query)
+	for it.Next() {
+		ids = append(ids, it.User().ID)
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		reports    []*ForgetReport
+		incomplete bool
+	)
+
+	for _, id := range ids {
+		report, err := c.ForgetUser(ctx, id, opts)
+		if errors.Is(err, ErrForgetIncomplete) {
+			incomplete = true
+		} else if err != nil {
+			return reports, err
+		}
+
+		reports = append(reports, report)
+	}
+
+	if incomplete {
+		return reports, ErrForgetIncomplete
+	}
+
+	return reports, nil
+}
+
+// forgetStep runs a single deletion with retries, treating records that are already gone as removed
+func (c *Client) forgetStep(ctx context.Context, opts *ForgetOptions, kind, id string, del func() error) ForgetAction {
+	action := ForgetAction{Kind: kind, ID: id}
+
+	if opts.DryRun {
+		action.Status = ForgetStatusWouldDelete
+		return action
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+
+	for {
+		action.Attempts++
+
+		err := del()
+		if err == nil {
+			action.Status = ForgetStatusDeleted
+			action.Error = ""
+			return action
+		}
+
+		if IsNotFound(err) {
+			action.Status = ForgetStatusNotFound
+			action.Error = ""
+			return action
+		}
+
+		action.Status = ForgetStatusFailed
+		action.Error = err.Error()
+
+		if action.Attempts >= maxAttempts || !isTransient(err) || sleep(ctx, backoff) != nil {
+			return action
+		}
+
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether a failed deletion may succeed when tried again
+func isTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.StatusCode)
+	}
+
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return isRetryableError(err)
+	}
+
+	return errors.Is(err, ErrRateLimitExceeded) || errors.Is(err, ErrCircuitOpen)
+}
+
+func (c *Client) finishForget(report *ForgetReport, opts *ForgetOptions) (*ForgetReport, error) {
+	report.CompletedAt = time.Now().UTC()
+
+	if len(opts.SigningKey) > 0 {
+		signature, err := report.sign(opts.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Signature = signature
+	}
+
+	return report, nil
+}
+
+func (r *ForgetReport) sign(key []byte) (string, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+
+	jsb, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(jsb)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verify reports whether the report's signature was made with key and the report was not modified since
+func (r *ForgetReport) Verify(key []byte) bool {
+	expected, err := r.sign(key)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(expected), []byte(r.Signature))
+}
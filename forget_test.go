@@ -0,0 +1,238 @@
+package convai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// erasureServer holds a single super user and records the deletions made against it
+// Deleting a path listed in failing answers with its status instead
+type erasureServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	user      *convai.SuperUser
+	deletions []string
+	failing   map[string]int
+}
+
+func newErasureServer(channelIDs ...string) *erasureServer {
+	s := &erasureServer{user: &convai.SuperUser{ID: uuid.NewV4()}, failing: make(map[string]int)}
+
+	for _, id := range channelIDs {
+		s.user.ChannelUsers = append(s.user.ChannelUsers, convai.ChannelUser{ChannelId: id, Channel: "sms"})
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == http.MethodGet && s.user != nil && r.URL.Path == "/users/super/"+s.user.ID.String():
+			json.NewEncoder(w).Encode(s.user)
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"not found"}`))
+		case r.Method == http.MethodDelete && s.failing[r.URL.Path] != 0:
+			status := s.failing[r.URL.Path]
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"code":%d,"message":"boom"}`, status)
+		case r.Method == http.MethodDelete:
+			s.deletions = append(s.deletions, r.URL.Path)
+			w.Write([]byte(`{}`))
+		}
+	}))
+
+	return s
+}
+
+func (s *erasureServer) deleted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.deletions...)
+}
+
+func TestForgetUserDeletesInOrder(t *testing.T) {
+	srv := newErasureServer("cu1", "cu2")
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+	key := []byte("secret")
+
+	report, err := client.ForgetUser(context.Background(), srv.user.ID, &convai.ForgetOptions{SigningKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"/users/session/cu1", "/users/channel/cu1",
+		"/users/session/cu2", "/users/channel/cu2",
+		"/users/super/" + srv.user.ID.String(),
+	}
+
+	if got := srv.deleted(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected deletions %v, got %v", want, got)
+	}
+
+	if !report.Complete || len(report.Actions) != len(want) {
+		t.Fatalf("expected a complete report with %d actions, got %+v", len(want), report)
+	}
+
+	if !report.Verify(key) {
+		t.Fatal("expected the signature to verify")
+	}
+
+	report.Actions = report.Actions[1:]
+	if report.Verify(key) {
+		t.Fatal("expected a modified report not to verify")
+	}
+}
+
+func TestForgetUserDryRun(t *testing.T) {
+	srv := newErasureServer("cu1")
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	report, err := client.ForgetUser(context.Background(), srv.user.ID, &convai.ForgetOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(srv.deleted()) != 0 {
+		t.Fatalf("expected a dry run not to delete anything, got %v", srv.deleted())
+	}
+
+	for _, action := range report.Actions {
+		if action.Status != convai.ForgetStatusWouldDelete {
+			t.Fatalf("expected every action to be %s, got %+v", convai.ForgetStatusWouldDelete, action)
+		}
+	}
+}
+
+func TestForgetUnknownUser(t *testing.T) {
+	srv := newErasureServer()
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	report, err := client.ForgetUser(context.Background(), uuid.NewV4(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Complete || len(report.Actions) != 1 || report.Actions[0].Status != convai.ForgetStatusNotFound {
+		t.Fatalf("expected a complete report with the super user not found, got %+v", report)
+	}
+}
+
+func TestForgetUserKeepsSuperUserWhenChannelUserRemains(t *testing.T) {
+	srv := newErasureServer("cu1", "cu2")
+	srv.failing["/users/channel/cu2"] = http.StatusInternalServerError
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	report, err := client.ForgetUser(context.Background(), srv.user.ID, &convai.ForgetOptions{MaxAttempts: 2, Backoff: time.Millisecond})
+	if !errors.Is(err, convai.ErrForgetIncomplete) {
+		t.Fatalf("expected ErrForgetIncomplete, got %v", err)
+	}
+
+	for _, path := range srv.deleted() {
+		if strings.HasPrefix(path, "/users/super/") {
+			t.Fatal("expected the super user to be kept while one of its channel users remains")
+		}
+	}
+
+	last := report.Actions[len(report.Actions)-1]
+	if last.Kind != convai.ForgetKindSuperUser || last.Status != convai.ForgetStatusSkipped {
+		t.Fatalf("expected the super user to be skipped, got %+v", last)
+	}
+
+	failed := report.Actions[len(report.Actions)-2]
+	if failed.Status != convai.ForgetStatusFailed || failed.Attempts != 2 {
+		t.Fatalf("expected the channel user to fail after 2 attempts, got %+v", failed)
+	}
+}
+
+func TestForgetUserKeepsChannelUserWhenSessionDeleteFails(t *testing.T) {
+	srv := newErasureServer("cu1")
+	srv.failing["/users/session/cu1"] = http.StatusInternalServerError
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	report, err := client.ForgetUser(context.Background(), srv.user.ID, &convai.ForgetOptions{MaxAttempts: 1})
+	if !errors.Is(err, convai.ErrForgetIncomplete) {
+		t.Fatalf("expected ErrForgetIncomplete, got %v", err)
+	}
+
+	if report.Complete {
+		t.Fatal("expected the report to be incomplete")
+	}
+
+	if got := srv.deleted(); len(got) != 0 {
+		t.Fatalf("expected the channel user and super user to be kept, got deletions %v", got)
+	}
+
+	delete(srv.failing, "/users/session/cu1")
+
+	report, err = client.ForgetUser(context.Background(), srv.user.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]string{}
+	for _, action := range report.Actions {
+		statuses[action.Kind] = action.Status
+	}
+
+	for _, kind := range []string{convai.ForgetKindSession, convai.ForgetKindChannelUser, convai.ForgetKindSuperUser} {
+		if statuses[kind] != convai.ForgetStatusDeleted {
+			t.Fatalf("expected the %s to be deleted on the second run, got %v", kind, report.Actions)
+		}
+	}
+}
+
+func TestForgetUserRetriesOnlyTransientErrors(t *testing.T) {
+	for _, tc := range []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusBadRequest, 1},
+		{http.StatusForbidden, 1},
+	} {
+		srv := newErasureServer("cu1")
+		srv.failing["/users/session/cu1"] = tc.status
+
+		client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+		report, err := client.ForgetUser(context.Background(), srv.user.ID, &convai.ForgetOptions{Backoff: time.Millisecond})
+		srv.Close()
+
+		if !errors.Is(err, convai.ErrForgetIncomplete) {
+			t.Fatalf("%d: expected ErrForgetIncomplete, got %v", tc.status, err)
+		}
+
+		session := report.Actions[0]
+		if session.Kind != convai.ForgetKindSession || session.Status != convai.ForgetStatusFailed || session.Attempts != tc.attempts {
+			t.Fatalf("%d: expected the session to fail after %d attempts, got %+v", tc.status, tc.attempts, session)
+		}
+	}
+}
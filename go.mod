@@ -1,5 +1,9 @@
 module github.com/datomar-labs-inc/convai-sdk-go
 
-go 1.12
+go 1.13
 
-require github.com/satori/go.uuid v1.2.0
+require (
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/satori/go.uuid v1.2.0
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+)
@@ -0,0 +1,27 @@
+package convai_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// fastRetries retries without noticeable delays so tests stay quick
+var fastRetries = convai.RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+}
+
+// tempDir creates a directory for a test, the caller removes it
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "convai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
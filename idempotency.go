@@ -0,0 +1,202 @@
+package convai
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// IdempotencyKeyHeader is the header the API uses to recognise a repeated mutating request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentEndpoints are the mutating calls that are sent with an idempotency key
+var idempotentEndpoints = map[string]bool{
+	"Trigger":            true,
+	"Broadcast":          true,
+	"CreateSuperUser":    true,
+	"CreateChannelUsers": true,
+	"MergeUsers":         true,
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey makes mutating calls made with ctx use key instead of a generated one
+// Use a key derived from your own job ID so that a job that is run twice is only performed once. Every mutating
+// call made with ctx shares the key, so derive a separate context for each call that must happen. Helpers that make
+// many calls, such as UserImporter and StartWaveBroadcast, derive a key per call from it
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// deriveIdempotencyKey gives one of the calls made by a helper its own key, built from the caller's key and suffix
+// ctx is returned as it is when the caller did not set a key
+func deriveIdempotencyKey(ctx context.Context, suffix string) context.Context {
+	key, ok := IdempotencyKey(ctx)
+	if !ok {
+		return ctx
+	}
+
+	return WithIdempotencyKey(ctx, key+"-"+suffix)
+}
+
+// IdempotencyKey returns the key set on ctx with WithIdempotencyKey
+func IdempotencyKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key, ok && key != ""
+}
+
+// IdempotencyStore remembers the results of mutating calls by their idempotency key, so a call repeated with
+// the same key is answered locally instead of being sent again
+type IdempotencyStore interface {
+	// Get returns the encoded result stored for key, ok is false when there is none
+	Get(ctx context.Context, key string) (result []byte, ok bool, err error)
+	Put(ctx context.Context, key string, result []byte) error
+}
+
+// WithIdempotencyStore makes the client consult store before sending a mutating call with a caller provided key
+// Generated keys are unique to a call, so they are never stored
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(o *clientOptions) {
+		o.idempotencyStore = store
+	}
+}
+
+// setIdempotencyKey attaches a key to a mutating call, it is set once per call so every retry sends the same key
+func setIdempotencyKey(call *Call) {
+	if !idempotentEndpoints[call.Endpoint] {
+		return
+	}
+
+	key, ok := IdempotencyKey(call.Context)
+	if !ok {
+		key = uuid.NewV4().String()
+		call.generatedKey = key
+	}
+
+	call.Header.Set(IdempotencyKeyHeader, key)
+}
+
+// storeKey returns the key a call's result is stored under, or false when the call should not use the store
+// Middleware may have replaced the key, in which case it counts as caller provided
+func (c *Client) storeKey(call *Call) (string, bool) {
+	key := call.Header.Get(IdempotencyKeyHeader)
+	if c.idempotencyStore == nil || key == "" || key == call.generatedKey {
+		return "", false
+	}
+
+	return call.Endpoint + ":" + key, true
+}
+
+// replayIdempotent answers a call from the idempotency store, ok is false when it has to be sent
+func (c *Client) replayIdempotent(call *Call) (*CallResult, bool, error) {
+	key, ok := c.storeKey(call)
+	if !ok {
+		return nil, false, nil
+	}
+
+	data, ok, err := c.idempotencyStore.Get(call.Context, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	if err := JSONCodec.Unmarshal(data, call.out); err != nil {
+		return nil, false, &DecodeError{Body: bodySnippet(data), Err: err}
+	}
+
+	return &CallResult{StatusCode: 200, Header: http.Header{}, Body: call.out}, true, nil
+}
+
+// rememberIdempotent stores the result of a successful call
+// Failing to store it is not reported, the call did happen and the API still dedupes by the key
+func (c *Client) rememberIdempotent(call *Call) {
+	key, ok := c.storeKey(call)
+	if !ok {
+		return
+	}
+
+	data, err := JSONCodec.Marshal(call.out)
+	if err != nil {
+		return
+	}
+
+	c.idempotencyStore.Put(call.Context, key, data)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps results in memory for a limited time
+type MemoryIdempotencyStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	results map[string]storedResult
+
+	// expiries lists the keys in the order they were put, which is the order they expire in as the ttl is fixed
+	expiries []storedExpiry
+}
+
+type storedResult struct {
+	data    []byte
+	expires time.Time
+}
+
+type storedExpiry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates a store that forgets results after ttl, a ttl of 0 keeps them forever
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:     ttl,
+		results: make(map[string]storedResult),
+	}
+}
+
+func (m *MemoryIdempotencyStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, ok := m.results[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !result.expires.IsZero() && time.Now().After(result.expires) {
+		delete(m.results, key)
+		return nil, false, nil
+	}
+
+	return result.data, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Put(ctx context.Context, key string, result []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ttl <= 0 {
+		m.results[key] = storedResult{data: result}
+		return nil
+	}
+
+	now := time.Now()
+
+	// Drop the results that expired since the last put so the store does not grow without bound, a key that was
+	// put again since is only dropped once its latest result expires
+	n := 0
+	for n < len(m.expiries) && now.After(m.expiries[n].expires) {
+		e := m.expiries[n]
+		if r, ok := m.results[e.key]; ok && r.expires.Equal(e.expires) {
+			delete(m.results, e.key)
+		}
+		n++
+	}
+	m.expiries = m.expiries[n:]
+
+	expires := now.Add(m.ttl)
+	m.results[key] = storedResult{data: result, expires: expires}
+	m.expiries = append(m.expiries, storedExpiry{key: key, expires: expires})
+
+	return nil
+}
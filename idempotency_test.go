@@ -0,0 +1,192 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+func TestIdempotencyKeyIsStableAcrossRetries(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	client := srv.Client(convai.WithRetryPolicy(fastRetries))
+	ctx := convai.WithIdempotencyKey(context.Background(), "say-1")
+
+	srv.FailNext("POST", "/executions/trigger", 503, 2)
+
+	if _, err := client.Say(ctx, "cu1", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, r := range srv.Requests() {
+		if r.Path == "/executions/trigger" {
+			keys = append(keys, r.Header.Get(convai.IdempotencyKeyHeader))
+		}
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(keys))
+	}
+
+	if keys[0] != "say-1" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Fatalf("expected the same key on every attempt, got %v", keys)
+	}
+}
+
+func TestIdempotencyStoreAnswersRepeatedCalls(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	client := srv.Client(convai.WithIdempotencyStore(convai.NewMemoryIdempotencyStore(0)))
+	ctx := convai.WithIdempotencyKey(context.Background(), "job-1")
+
+	first, err := client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1", Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := len(srv.Requests())
+
+	second, err := client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1", Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(srv.Requests()) != sent {
+		t.Fatal("expected the repeated call to be answered from the store")
+	}
+
+	if first.ID != second.ID {
+		t.Fatalf("expected the stored execution %s, got %s", first.ID, second.ID)
+	}
+}
+
+func TestImportDerivesKeyPerRow(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	importer := &convai.UserImporter{
+		Client:  srv.Client(),
+		Format:  convai.FormatCSV,
+		Mapping: convai.ImportMapping{Channels: []convai.ChannelColumn{{Channel: "sms", Column: "phone"}}},
+	}
+
+	ctx := convai.WithIdempotencyKey(context.Background(), "job-42")
+
+	report, err := importer.Import(ctx, strings.NewReader("name,phone\na,1\nb,2\nc,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Succeeded != 3 {
+		t.Fatalf("expected 3 rows to succeed, got %+v", report)
+	}
+
+	if users := srv.SuperUsers(); len(users) != 3 {
+		t.Fatalf("expected 3 users to be created, got %d", len(users))
+	}
+}
+
+func TestConversationDerivesKeyPerTurn(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	ctx := convai.WithIdempotencyKey(context.Background(), "chat")
+	cv := srv.Client().Converse("cu1")
+
+	for _, text := range []string{"one", "two"} {
+		reply, err := cv.Say(ctx, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reply.Text() != text {
+			t.Fatalf("expected the reply to %q, got %q", text, reply.Text())
+		}
+	}
+
+	if n := len(srv.Executions()); n != 2 {
+		t.Fatalf("expected 2 executions, got %d", n)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiresResults(t *testing.T) {
+	store := convai.NewMemoryIdempotencyStore(20 * time.Millisecond)
+	ctx := context.Background()
+
+	store.Put(ctx, "a", []byte("1"))
+	store.Put(ctx, "b", []byte("2"))
+
+	time.Sleep(30 * time.Millisecond)
+
+	// b is put again, so only its newer result counts
+	store.Put(ctx, "b", []byte("3"))
+
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Fatal("expected a to have expired")
+	}
+
+	if data, ok, _ := store.Get(ctx, "b"); !ok || string(data) != "3" {
+		t.Fatalf("expected the newer result for b, got %q", data)
+	}
+}
+
+func TestFakeRefusesKeyReusedForAnotherRequest(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+
+	client := srv.Client()
+	ctx := convai.WithIdempotencyKey(context.Background(), "job-1")
+
+	if _, err := client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var apiErr *convai.APIError
+	if _, err := client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1", Text: "bye"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a 422 for a key reused with another body, got %v", err)
+	}
+
+	if n := len(srv.Executions()); n != 1 {
+		t.Fatalf("expected the second trigger not to run, got %d executions", n)
+	}
+}
+
+func TestFakeForgetsExpiredKeys(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser(convai.SuperUser{ChannelUsers: []convai.ChannelUser{{ChannelId: "cu1", Channel: "sms"}}})
+	srv.SetIdempotencyTTL(10 * time.Millisecond)
+
+	client := srv.Client()
+	ctx := convai.WithIdempotencyKey(context.Background(), "job-1")
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1", Text: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if n := len(srv.Executions()); n != 2 {
+		t.Fatalf("expected the trigger to run again once its key expired, got %d executions", n)
+	}
+}
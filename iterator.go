@@ -0,0 +1,252 @@
+package convai
+
+import (
+	"context"
+)
+
+// DefaultPageSize is used by the iterators when the query does not set a limit
+const DefaultPageSize = 100
+
+// fetchPage loads limit items starting at offset, returning the items, how many there were,
+// and the total number of matches (or -1 when the endpoint does not report one)
+type fetchPage func(ctx context.Context, offset, limit int) (items interface{}, n int, total int, err error)
+
+type page struct {
+	items interface{}
+	n     int
+	total int
+	err   error
+}
+
+// pager walks an offset paginated endpoint, optionally fetching the following page in the background
+type pager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  fetchPage
+
+	offset int
+	limit  int
+	total  int
+	done   bool
+	err    error
+
+	prefetch bool
+	pending  chan page
+}
+
+func newPager(ctx context.Context, offset, limit int, fetch fetchPage) *pager {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &pager{
+		ctx:    ctx,
+		cancel: cancel,
+		fetch:  fetch,
+		offset: offset,
+		limit:  limit,
+		total:  -1,
+	}
+}
+
+func (p *pager) load(offset int) page {
+	items, n, total, err := p.fetch(p.ctx, offset, p.limit)
+	return page{items: items, n: n, total: total, err: err}
+}
+
+// next returns the items of the next page, or false once the results are exhausted or an error occurred
+func (p *pager) next() (interface{}, bool) {
+	if p.done {
+		return nil, false
+	}
+
+	var pg page
+	if p.pending != nil {
+		pg = <-p.pending
+		p.pending = nil
+	} else {
+		pg = p.load(p.offset)
+	}
+
+	if pg.err != nil {
+		p.err = pg.err
+		p.finish()
+		return nil, false
+	}
+
+	p.offset += pg.n
+	if pg.total >= 0 {
+		p.total = pg.total
+	}
+
+	// A short page does not mean the end, the API may cap the page size below the requested limit
+	if pg.n == 0 || (p.total >= 0 && p.offset >= p.total) {
+		p.finish()
+	} else if p.prefetch {
+		p.pending = make(chan page, 1)
+		go func(offset int, pending chan page) {
+			pending <- p.load(offset)
+		}(p.offset, p.pending)
+	}
+
+	if pg.n == 0 {
+		return nil, false
+	}
+
+	return pg.items, true
+}
+
+func (p *pager) finish() {
+	p.done = true
+	p.cancel()
+}
+
+// ExecutionIterator walks every execution matched by an ExecutionMatcher, one page at a time
+type ExecutionIterator struct {
+	pager   *pager
+	page    []Execution
+	current Execution
+}
+
+// IterateExecutions returns an iterator over all executions matching matcher
+// The matcher's limit is used as the page size and its offset as the starting point, a nil matcher matches every execution
+func (c *Client) IterateExecutions(ctx context.Context, matcher *ExecutionMatcher) *ExecutionIterator {
+	if matcher == nil {
+		matcher = NewExecutionMatcher()
+	}
+
+	m := *matcher
+
+	fetch := func(ctx context.Context, offset, limit int) (interface{}, int, int, error) {
+		m.Off = offset
+		m.Lim = limit
+
+		res, err := c.QueryExecutionsWithContext(ctx, &m)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		return res.Executions, len(res.Executions), res.Total, nil
+	}
+
+	return &ExecutionIterator{pager: newPager(ctx, m.Off, m.Lim, fetch)}
+}
+
+// Prefetch makes the iterator request the next page while the current one is being consumed
+// It must be called before the first call to Next
+func (it *ExecutionIterator) Prefetch() *ExecutionIterator {
+	it.pager.prefetch = true
+	return it
+}
+
+// Next advances to the next execution, it returns false when there are no more or an error occurred
+func (it *ExecutionIterator) Next() bool {
+	for len(it.page) == 0 {
+		items, ok := it.pager.next()
+		if !ok {
+			return false
+		}
+
+		it.page = items.([]Execution)
+	}
+
+	it.current = it.page[0]
+	it.page = it.page[1:]
+
+	return true
+}
+
+// Execution returns the execution the iterator is currently positioned on
+func (it *ExecutionIterator) Execution() *Execution {
+	return &it.current
+}
+
+// Total returns the total number of matching executions reported by the API, or -1 before the first page
+func (it *ExecutionIterator) Total() int {
+	return it.pager.total
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ExecutionIterator) Err() error {
+	return it.pager.err
+}
+
+// Close stops the iteration and any outstanding prefetch
+func (it *ExecutionIterator) Close() {
+	it.page = nil
+	it.pager.finish()
+}
+
+// UserIterator walks every super user matched by a UserQuery, one page at a time
+type UserIterator struct {
+	pager   *pager
+	page    []SuperUser
+	current SuperUser
+}
+
+// IterateUsers returns an iterator over all users matching query
+// The query's limit is used as the page size and its offset as the starting point, a nil query is sent as an empty one
+func (c *Client) IterateUsers(ctx context.Context, query *UserQuery) *UserIterator {
+	if query == nil {
+		query = &UserQuery{}
+	}
+
+	q := *query
+
+	fetch := func(ctx context.Context, offset, limit int) (interface{}, int, int, error) {
+		q.Offset = offset
+		q.Limit = limit
+
+		res, err := c.QueryUsersWithContext(ctx, &q)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		// Count is not guaranteed to be the total number of matches, so iteration stops on an empty page instead
+		return res.Users, len(res.Users), -1, nil
+	}
+
+	return &UserIterator{pager: newPager(ctx, q.Offset, q.Limit, fetch)}
+}
+
+// Prefetch makes the iterator request the next page while the current one is being consumed
+// It must be called before the first call to Next
+func (it *UserIterator) Prefetch() *UserIterator {
+	it.pager.prefetch = true
+	return it
+}
+
+// Next advances to the next user, it returns false when there are no more or an error occurred
+func (it *UserIterator) Next() bool {
+	for len(it.page) == 0 {
+		items, ok := it.pager.next()
+		if !ok {
+			return false
+		}
+
+		it.page = items.([]SuperUser)
+	}
+
+	it.current = it.page[0]
+	it.page = it.page[1:]
+
+	return true
+}
+
+// User returns the user the iterator is currently positioned on
+func (it *UserIterator) User() *SuperUser {
+	return &it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *UserIterator) Err() error {
+	return it.pager.err
+}
+
+// Close stops the iteration and any outstanding prefetch
+func (it *UserIterator) Close() {
+	it.page = nil
+	it.pager.finish()
+}
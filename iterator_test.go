@@ -0,0 +1,243 @@
+package convai_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// userServer serves n users and never returns more than max of them per page, it records the offset of every query
+func userServer(n, max int) (*httptest.Server, func() []int) {
+	var (
+		mu      sync.Mutex
+		offsets []int
+	)
+
+	users := make([]convai.SuperUser, n)
+	for i := range users {
+		users[i] = convai.SuperUser{ID: uuid.NewV4()}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query convai.UserQuery
+		json.NewDecoder(r.Body).Decode(&query)
+
+		mu.Lock()
+		offsets = append(offsets, query.Offset)
+		mu.Unlock()
+
+		end := query.Offset + query.Limit
+		if end > query.Offset+max {
+			end = query.Offset + max
+		}
+		if end > len(users) {
+			end = len(users)
+		}
+
+		res := convai.UserQueryResult{Users: []convai.SuperUser{}, Count: uint64(len(users))}
+		if query.Offset < end {
+			res.Users = users[query.Offset:end]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]int{}, offsets...)
+	}
+}
+
+func TestIterateUsersContinuesPastCappedPages(t *testing.T) {
+	srv, _ := userServer(5, 2)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	seen := map[uuid.UUID]bool{}
+
+	it := client.IterateUsers(context.Background(), &convai.UserQuery{Limit: 10})
+	for it.Next() {
+		seen[it.User().ID] = true
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 users, got %d", len(seen))
+	}
+}
+
+func TestIterateUsersPrefetch(t *testing.T) {
+	srv, offsets := userServer(7, 100)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	seen := map[uuid.UUID]bool{}
+
+	it := client.IterateUsers(context.Background(), &convai.UserQuery{Limit: 3}).Prefetch()
+	for it.Next() {
+		seen[it.User().ID] = true
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 7 {
+		t.Fatalf("expected 7 distinct users, got %d", len(seen))
+	}
+
+	// Every page is requested exactly once, in order, until an empty page ends the iteration
+	want := []int{0, 3, 6, 7}
+	got := offsets()
+	if len(got) != len(want) {
+		t.Fatalf("expected pages at %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected pages at %v, got %v", want, got)
+		}
+	}
+}
+
+func TestIterateUsersStartsAtOffset(t *testing.T) {
+	srv, offsets := userServer(5, 100)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	n := 0
+	it := client.IterateUsers(context.Background(), &convai.UserQuery{Offset: 2, Limit: 2})
+	for it.Next() {
+		n++
+	}
+
+	if n != 3 || offsets()[0] != 2 {
+		t.Fatalf("expected the 3 users after offset 2, got %d starting at %v", n, offsets())
+	}
+}
+
+func TestIterateExecutionsStopsAtTotal(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var matcher convai.ExecutionMatcher
+		json.NewDecoder(r.Body).Decode(&matcher)
+
+		mu.Lock()
+		queries++
+		mu.Unlock()
+
+		res := convai.ExecutionQueryResult{Executions: []convai.Execution{}, Total: 5}
+		for i := matcher.Off; i < matcher.Off+matcher.Lim && i < 5; i++ {
+			res.Executions = append(res.Executions, convai.Execution{ID: uuid.NewV4()})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	n := 0
+	it := client.IterateExecutions(context.Background(), convai.NewExecutionMatcher().Limit(2)).Prefetch()
+	for it.Next() {
+		n++
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 5 || it.Total() != 5 {
+		t.Fatalf("expected 5 executions, got %d of %d", n, it.Total())
+	}
+
+	// The last page reaches the total, so no empty page is requested after it
+	mu.Lock()
+	defer mu.Unlock()
+
+	if queries != 3 {
+		t.Fatalf("expected 3 pages to be requested, got %d", queries)
+	}
+}
+
+func TestIteratorStopsOnError(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries++
+		n := queries
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if n > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":500,"message":"boom"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(convai.UserQueryResult{Users: []convai.SuperUser{{ID: uuid.NewV4()}, {ID: uuid.NewV4()}}})
+	}))
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	n := 0
+	it := client.IterateUsers(context.Background(), &convai.UserQuery{Limit: 2})
+	for it.Next() {
+		n++
+	}
+
+	if n != 2 || it.Err() == nil {
+		t.Fatalf("expected the first page and then the error, got %d users and %v", n, it.Err())
+	}
+}
+
+func TestIteratorsTreatNilAsEmpty(t *testing.T) {
+	srv, offsets := userServer(3, 100)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	n := 0
+	users := client.IterateUsers(context.Background(), nil)
+	for users.Next() {
+		n++
+	}
+
+	if err := users.Err(); err != nil || n != 3 || offsets()[0] != 0 {
+		t.Fatalf("expected all 3 users from offset 0, got %d starting at %v: %v", n, offsets(), err)
+	}
+
+	executions := client.IterateExecutions(context.Background(), nil)
+	for executions.Next() {
+	}
+
+	if err := executions.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package convai
+
+import (
+	"context"
+	"net/http"
+)
+
+// Call describes a single API call as seen by middleware
+type Call struct {
+	Context context.Context
+
+	// Endpoint is the name of the Client method that made the call, e.g. "QueryUsers"
+	Endpoint string
+	Method   string
+	Path     string
+
+	// Body is the request body before it is encoded
+	Body interface{}
+
+	// Header holds extra headers to send, middleware may add to it
+	Header http.Header
+
+	out          interface{}
+	generatedKey string
+}
+
+// CallResult describes the response to a Call
+// It is also returned alongside API and decode errors so middleware can inspect failed responses
+type CallResult struct {
+	StatusCode int
+	Header     http.Header
+
+	// Body is the decoded response, it is only set when the call succeeded
+	Body interface{}
+
+	// Attempts is the number of HTTP requests made, including retries
+	Attempts int
+}
+
+// Doer performs an API call
+type Doer interface {
+	Do(call *Call) (*CallResult, error)
+}
+
+// DoerFunc adapts a function to the Doer interface
+type DoerFunc func(call *Call) (*CallResult, error)
+
+func (f DoerFunc) Do(call *Call) (*CallResult, error) {
+	return f(call)
+}
+
+// Middleware wraps a Doer, typically doing something before and/or after calling next
+type Middleware func(next Doer) Doer
+
+// Use appends middleware to the chain every API call passes through
+// The first middleware registered is the outermost one. Use is not safe to call concurrently with API calls
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
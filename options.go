@@ -0,0 +1,65 @@
+package convai
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a Client created with NewClient
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	timeoutSet bool
+	userAgent  string
+	headers    http.Header
+
+	codec       Codec
+	gzip        bool
+	gzipMinSize int
+	retryPolicy RetryPolicy
+	rateLimits  map[EndpointGroup]RateLimit
+
+	circuitBreaker   *CircuitBreaker
+	idempotencyStore IdempotencyStore
+}
+
+// WithHTTPClient makes the client send requests through hc, allowing custom transports and proxies
+func WithHTTPClient(hc *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = hc
+	}
+}
+
+// WithBaseURL points the client at a different API host, e.g. a staging environment
+func WithBaseURL(baseURL string) Option {
+	return func(o *clientOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithTimeout sets the overall timeout of each request
+// It takes precedence over the timeout of a client passed to WithHTTPClient
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+		o.timeoutSet = true
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithHeader adds a header that is sent with every request
+// The Authorization and Content-Type headers are managed by the client and cannot be overridden
+func WithHeader(key, value string) Option {
+	return func(o *clientOptions) {
+		o.headers.Add(key, value)
+	}
+}
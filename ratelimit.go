@@ -0,0 +1,128 @@
+package convai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointGroup identifies a family of API endpoints that share a rate limit
+type EndpointGroup string
+
+const (
+	EndpointUsers      EndpointGroup = "users"
+	EndpointExecutions EndpointGroup = "executions"
+	EndpointBroadcast  EndpointGroup = "broadcast"
+)
+
+// ErrRateLimitExceeded is returned when the client side rate limiter refuses a request
+// This is distinct from ErrRateLimited, which means the API itself rejected the request
+var ErrRateLimitExceeded = errors.New("client side rate limit exceeded")
+
+// RateLimit configures a token bucket that allows bursts of up to Burst requests,
+// refilling at RequestsPerSecond
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+
+	// FailFast returns ErrRateLimitExceeded instead of waiting when no token is available
+	FailFast bool
+}
+
+// WithRateLimit limits the requests made to an endpoint group
+// Requests wait for a token until their context is done, and fail straight away if the context's
+// deadline would pass before a token becomes available
+func WithRateLimit(group EndpointGroup, limit RateLimit) Option {
+	return func(o *clientOptions) {
+		if o.rateLimits == nil {
+			o.rateLimits = make(map[EndpointGroup]RateLimit)
+		}
+
+		o.rateLimits[group] = limit
+	}
+}
+
+// endpointGroup classifies an API path, sessions share the users group
+func endpointGroup(path string) EndpointGroup {
+	switch {
+	case strings.HasPrefix(path, "/executions/broadcast"):
+		return EndpointBroadcast
+	case strings.HasPrefix(path, "/executions"):
+		return EndpointExecutions
+	default:
+		return EndpointUsers
+	}
+}
+
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	failFast bool
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:     limit.RequestsPerSecond,
+		burst:    burst,
+		tokens:   burst,
+		last:     time.Now(),
+		failFast: limit.FailFast,
+	}
+}
+
+// refill must be called with the lock held
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait takes a token from the bucket, blocking until one is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+
+	now := time.Now()
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+
+	if b.failFast || b.rate <= 0 {
+		b.mu.Unlock()
+		return ErrRateLimitExceeded
+	}
+
+	delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < delay {
+		b.mu.Unlock()
+		return ErrRateLimitExceeded
+	}
+
+	// Reserve the token now so that concurrent callers queue up behind this one
+	b.tokens--
+	b.mu.Unlock()
+
+	if err := sleep(ctx, delay); err != nil {
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
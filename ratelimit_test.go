@@ -0,0 +1,163 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// countingServer answers every request with an empty JSON object and counts the requests per path
+type countingServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	paths map[string]int
+}
+
+func newCountingServer() *countingServer {
+	s := &countingServer{paths: make(map[string]int)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.paths[r.URL.Path]++
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+
+	return s
+}
+
+func (s *countingServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.paths[path]
+}
+
+func TestRateLimitFailFastAfterBurst(t *testing.T) {
+	srv := newCountingServer()
+	defer srv.Close()
+
+	client := convai.NewClient("key",
+		convai.WithBaseURL(srv.URL),
+		convai.WithRateLimit(convai.EndpointUsers, convai.RateLimit{RequestsPerSecond: 0.1, Burst: 2, FailFast: true}),
+	)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+	if !errors.Is(err, convai.ErrRateLimitExceeded) {
+		t.Fatalf("expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	if n := srv.count("/users/super/query"); n != 2 {
+		t.Fatalf("expected the refused request not to be sent, got %d requests", n)
+	}
+
+	// Other endpoint groups have their own bucket, and groups without a limit are not limited at all
+	if _, err := client.QueryExecutionsWithContext(context.Background(), convai.NewExecutionMatcher()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitWaitsForTokens(t *testing.T) {
+	srv := newCountingServer()
+	defer srv.Close()
+
+	client := convai.NewClient("key",
+		convai.WithBaseURL(srv.URL),
+		convai.WithRateLimit(convai.EndpointExecutions, convai.RateLimit{RequestsPerSecond: 50, Burst: 1}),
+	)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.QueryExecutionsWithContext(context.Background(), convai.NewExecutionMatcher()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The first request uses the burst, the other three queue up 20ms apart
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the requests to be spread out, they took %s", elapsed)
+	}
+
+	if n := srv.count("/executions/query"); n != 4 {
+		t.Fatalf("expected all 4 requests to be sent, got %d", n)
+	}
+}
+
+func TestRateLimitRespectsDeadline(t *testing.T) {
+	srv := newCountingServer()
+	defer srv.Close()
+
+	client := convai.NewClient("key",
+		convai.WithBaseURL(srv.URL),
+		convai.WithRateLimit(convai.EndpointBroadcast, convai.RateLimit{RequestsPerSecond: 1, Burst: 1}),
+	)
+
+	if _, err := client.BroadcastWithContext(context.Background(), &convai.BroadcastInput{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := client.BroadcastWithContext(ctx, &convai.BroadcastInput{})
+	if !errors.Is(err, convai.ErrRateLimitExceeded) {
+		t.Fatalf("expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	// The next token is a second away, past the deadline, so the request fails without waiting
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("expected the request to fail straight away, it took %s", elapsed)
+	}
+}
+
+func TestRateLimitWaitReportsCancellation(t *testing.T) {
+	srv := newCountingServer()
+	defer srv.Close()
+
+	client := convai.NewClient("key",
+		convai.WithBaseURL(srv.URL),
+		convai.WithRateLimit(convai.EndpointUsers, convai.RateLimit{RequestsPerSecond: 1, Burst: 1}),
+	)
+
+	if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := client.QueryUsersWithContext(ctx, &convai.UserQuery{})
+
+	var transportErr *convai.TransportError
+	if !errors.As(err, &transportErr) || !errors.Is(err, context.Canceled) || transportErr.Path != "/users/super/query" {
+		t.Fatalf("expected a TransportError caused by the cancellation, got %v", err)
+	}
+
+	if n := srv.count("/users/super/query"); n != 1 {
+		t.Fatalf("expected the canceled request not to be sent, got %d requests", n)
+	}
+}
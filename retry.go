@@ -0,0 +1,143 @@
+package convai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how the client retries failed requests
+// Only requests that are safe to repeat are retried: non-POST requests, the read only query endpoints
+// and requests carrying an Idempotency-Key chosen by the caller, see WithIdempotencyKey. A mutating call sent
+// with the key the client generated for it is not retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 2 disable retries
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, it grows by Multiplier on every subsequent retry
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter randomizes each delay by up to the given fraction (0 to 1) to avoid synchronized retries
+	Jitter float64
+}
+
+// DefaultRetryPolicy is a sensible policy for most callers, it is not enabled unless passed to WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetryPolicy enables automatic retries of transport errors, 429 and 5xx responses
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// RetryError is returned when a request failed with a transport error after more than one attempt
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (r *RetryError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %s", r.Attempts, r.Err.Error())
+}
+
+func (r *RetryError) Unwrap() error {
+	return r.Err
+}
+
+// readOnlyPaths are POST endpoints that do not modify anything and can therefore always be retried
+var readOnlyPaths = map[string]bool{
+	"/executions/query":            true,
+	"/users/super/query":           true,
+	"/users/super/query/reachable": true,
+}
+
+// isRetryableRequest reports whether req is safe to send again, generatedKey is the key the client made up for it
+func isRetryableRequest(req *http.Request, path, generatedKey string) bool {
+	if req.Method != http.MethodPost {
+		return true
+	}
+
+	key := req.Header.Get(IdempotencyKeyHeader)
+
+	return readOnlyPaths[path] || (key != "" && key != generatedKey)
+}
+
+// isRetryableError reports whether a transport error may go away on retry
+// Errors opt out with a Retryable method, as convaitest does for requests a cassette has no recording of
+func isRetryableError(err error) bool {
+	var r interface{ Retryable() bool }
+	return !errors.As(err, &r) || r.Retryable()
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff returns the delay before the given retry (starting at 1)
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(r.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if r.MaxBackoff > 0 && delay > float64(r.MaxBackoff) {
+		delay = float64(r.MaxBackoff)
+	}
+
+	if r.Jitter > 0 {
+		delay += delay * r.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// sleep waits for d, returning early with the context's error if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,172 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+)
+
+// flakyServer fails the first requests with status, then answers every request with an empty user query result
+type flakyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	status   int
+	header   http.Header
+	requests int
+}
+
+func newFlakyServer(failures, status int) *flakyServer {
+	s := &flakyServer{failures: failures, status: status, header: http.Header{}}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		fail := s.requests <= s.failures
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if fail {
+			for key, values := range s.header {
+				w.Header()[key] = values
+			}
+
+			w.WriteHeader(s.status)
+			fmt.Fprintf(w, `{"code":%d,"message":"try again"}`, s.status)
+			return
+		}
+
+		w.Write([]byte(`{"Users":[],"Count":0}`))
+	}))
+
+	return s
+}
+
+func (s *flakyServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func TestRetryRecoversFromServerErrors(t *testing.T) {
+	srv := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(fastRetries))
+
+	if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := srv.count(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	srv := newFlakyServer(10, http.StatusInternalServerError)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(fastRetries))
+
+	_, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{})
+
+	var apiErr *convai.APIError
+	if !errors.As(err, &apiErr) || apiErr.Attempts != fastRetries.MaxAttempts {
+		t.Fatalf("expected an API error after %d attempts, got %v", fastRetries.MaxAttempts, err)
+	}
+
+	if n := srv.count(); n != fastRetries.MaxAttempts {
+		t.Fatalf("expected %d attempts, got %d", fastRetries.MaxAttempts, n)
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	srv := newFlakyServer(1, http.StatusTooManyRequests)
+	srv.header.Set("Retry-After", "0")
+	defer srv.Close()
+
+	// Without Retry-After the client would wait an hour before its second attempt
+	policy := convai.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.QueryUsersWithContext(ctx, &convai.UserQuery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := srv.count(); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	srv := newFlakyServer(1, http.StatusBadRequest)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(fastRetries))
+
+	if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); err == nil {
+		t.Fatal("expected the 400 to be returned")
+	}
+
+	if n := srv.count(); n != 1 {
+		t.Fatalf("expected a single attempt, got %d", n)
+	}
+}
+
+func TestRetrySkipsUnsafePosts(t *testing.T) {
+	srv := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(fastRetries))
+
+	if _, err := client.TriggerWithContext(context.Background(), &convai.TriggerRequest{ChannelID: "cu1"}); err == nil {
+		t.Fatal("expected the 503 to be returned")
+	}
+
+	if n := srv.count(); n != 1 {
+		t.Fatalf("expected a trigger with a generated idempotency key not to be retried, got %d attempts", n)
+	}
+}
+
+func TestRetryRetriesKeyedPosts(t *testing.T) {
+	srv := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL), convai.WithRetryPolicy(fastRetries))
+	ctx := convai.WithIdempotencyKey(context.Background(), "trigger-1")
+
+	client.TriggerWithContext(ctx, &convai.TriggerRequest{ChannelID: "cu1"})
+
+	if n := srv.count(); n != 2 {
+		t.Fatalf("expected a trigger with an idempotency key to be retried, got %d attempts", n)
+	}
+}
+
+func TestNoRetriesByDefault(t *testing.T) {
+	srv := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client := convai.NewClient("key", convai.WithBaseURL(srv.URL))
+
+	if _, err := client.QueryUsersWithContext(context.Background(), &convai.UserQuery{}); err == nil {
+		t.Fatal("expected the 503 to be returned")
+	}
+
+	if n := srv.count(); n != 1 {
+		t.Fatalf("expected a single attempt, got %d", n)
+	}
+}
@@ -0,0 +1,197 @@
+package convai
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// UserExporter streams users with their channel users and sessions to JSONL or CSV
+// Users are fetched a page at a time, so memory use does not depend on the size of the environment
+type UserExporter struct {
+	Client *Client
+	Format RecordFormat
+
+	// Query selects the users to export, every user is exported when it is nil
+	Query *UserQuery
+
+	// Columns selects the user data keys to export. JSONL records keep all data when it is empty,
+	// CSV needs the keys up front and has no data columns when it is empty
+	Columns []string
+
+	// FetchSessions loads the session of channel users that were returned without one
+	FetchSessions bool
+}
+
+// csvBaseColumns are written before the data columns of a CSV export
+var csvBaseColumns = []string{"super_user_id", "environment_id", "created_at", "updated_at"}
+
+// csvChannelColumns are written after the data columns of a CSV export
+var csvChannelColumns = []string{"channel", "channel_id", "session_id", "session_stack"}
+
+// Export writes every matching user to w and returns how many users were written
+// JSONL exports contain one SuperUser per line. CSV exports contain one row per channel user,
+// with the super user's columns repeated, and a single row for users without channel users
+func (e *UserExporter) Export(ctx context.Context, w io.Writer) (int, error) {
+	query := e.Query
+	if query == nil {
+		query = &UserQuery{Mode: UQMAll, Limit: DefaultPageSize}
+	}
+
+	var write func(user *SuperUser) error
+
+	switch e.Format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(user *SuperUser) error {
+			return enc.Encode(user)
+		}
+
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+
+		header := append([]string{}, csvBaseColumns...)
+		header = append(header, e.Columns...)
+		header = append(header, csvChannelColumns...)
+
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+
+		write = func(user *SuperUser) error {
+			for _, record := range e.csvRecords(user) {
+				if err := cw.Write(record); err != nil {
+					return err
+				}
+			}
+
+			cw.Flush()
+			return cw.Error()
+		}
+
+	default:
+		return 0, fmt.Errorf("unsupported export format %q", e.Format)
+	}
+
+	it := e.Client.IterateUsers(ctx, query).Prefetch()
+	defer it.Close()
+
+	count := 0
+	for it.Next() {
+		user := it.User()
+
+		if err := e.prepare(ctx, user); err != nil {
+			return count, err
+		}
+
+		if err := write(user); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, it.Err()
+}
+
+// prepare applies the column selection and loads missing sessions
+func (e *UserExporter) prepare(ctx context.Context, user *SuperUser) error {
+	if len(e.Columns) > 0 {
+		data := make(map[string]interface{}, len(e.Columns))
+		for _, column := range e.Columns {
+			if v, ok := user.Data[column]; ok {
+				data[column] = v
+			}
+		}
+		user.Data = data
+	}
+
+	if !e.FetchSessions {
+		return nil
+	}
+
+	for i := range user.ChannelUsers {
+		cu := &user.ChannelUsers[i]
+		if cu.Session != nil {
+			continue
+		}
+
+		session, err := e.Client.GetSessionWithContext(ctx, cu.ChannelId)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("fetching session of channel user %s: %w", cu.ChannelId, err)
+		}
+
+		cu.Session = session
+	}
+
+	return nil
+}
+
+func (e *UserExporter) csvRecords(user *SuperUser) [][]string {
+	base := []string{
+		user.ID.String(),
+		user.EnvironmentID.String(),
+		formatTime(user.CreatedAt),
+		formatTime(user.UpdatedAt),
+	}
+
+	for _, column := range e.Columns {
+		base = append(base, csvValue(user.Data[column]))
+	}
+
+	if len(user.ChannelUsers) == 0 {
+		return [][]string{append(base, make([]string, len(csvChannelColumns))...)}
+	}
+
+	records := make([][]string, 0, len(user.ChannelUsers))
+	for _, cu := range user.ChannelUsers {
+		record := append([]string{}, base...)
+		record = append(record, cu.Channel, cu.ChannelId)
+
+		if cu.Session != nil {
+			stack := ""
+			if len(cu.Session.Stack.Frames) > 0 {
+				stack = csvValue(cu.Session.Stack.Frames)
+			}
+
+			record = append(record, cu.Session.ID.String(), stack)
+		} else {
+			record = append(record, "", "")
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// csvValue writes strings as they are and everything else as JSON
+func csvValue(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	}
+
+	jsb, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(jsb)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,160 @@
+package convai_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+// exportServer holds a user with two channel users and a user without any
+func exportServer() (*convaitest.Server, convai.SuperUser, convai.SuperUser) {
+	srv := convaitest.NewServer()
+
+	ada := srv.AddUser(convai.SuperUser{
+		Data: map[string]interface{}{"name": "Ada", "age": 36, "secret": "x"},
+		ChannelUsers: []convai.ChannelUser{
+			{ChannelId: "cu1", Channel: "sms"},
+			{ChannelId: "cu2", Channel: "web"},
+		},
+	})
+	bob := srv.AddUser(convai.SuperUser{Data: map[string]interface{}{"name": "Bob"}})
+
+	return srv, ada, bob
+}
+
+func TestExportCSVColumns(t *testing.T) {
+	srv, ada, bob := exportServer()
+	defer srv.Close()
+
+	exporter := &convai.UserExporter{Client: srv.Client(), Format: convai.FormatCSV, Columns: []string{"name", "age"}}
+
+	var buf bytes.Buffer
+	n, err := exporter.Export(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected 2 users to be exported, got %d", n)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := "super_user_id,environment_id,created_at,updated_at,name,age,channel,channel_id,session_id,session_stack"
+	if got := strings.Join(records[0], ","); got != header {
+		t.Fatalf("expected header %q, got %q", header, got)
+	}
+
+	// Ada has a row per channel user, Bob a single row without channel columns
+	rows := map[string][]string{}
+	for _, record := range records[1:] {
+		rows[record[0]+" "+record[7]] = record
+	}
+
+	for key, want := range map[string]string{
+		ada.ID.String() + " cu1": "Ada,36,sms,cu1",
+		ada.ID.String() + " cu2": "Ada,36,web,cu2",
+		bob.ID.String() + " ":    "Bob,,,",
+	} {
+		record, ok := rows[key]
+		if !ok {
+			t.Fatalf("expected a row for %s, got %v", key, records[1:])
+		}
+
+		if got := strings.Join(record[4:8], ","); got != want {
+			t.Fatalf("expected %s to have %q, got %q", key, want, got)
+		}
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("expected a header and 3 rows, got %d records", len(records))
+	}
+}
+
+func TestExportJSONLKeepsSelectedData(t *testing.T) {
+	srv, ada, _ := exportServer()
+	defer srv.Close()
+
+	exporter := &convai.UserExporter{Client: srv.Client(), Format: convai.FormatJSONL, Columns: []string{"name"}}
+
+	var buf bytes.Buffer
+	if _, err := exporter.Export(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per user, got %d", len(lines))
+	}
+
+	for _, line := range lines {
+		var user convai.SuperUser
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(user.Data) != 1 || user.Data["name"] == nil {
+			t.Fatalf("expected only the name to be exported, got %v", user.Data)
+		}
+
+		if user.ID == ada.ID && len(user.ChannelUsers) != 2 {
+			t.Fatalf("expected Ada's channel users to be exported, got %+v", user.ChannelUsers)
+		}
+	}
+}
+
+func TestExportPagesThroughUsers(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	for i := 0; i < 5; i++ {
+		srv.AddUser(convai.SuperUser{Data: map[string]interface{}{"name": fmt.Sprintf("user%d", i)}})
+	}
+
+	exporter := &convai.UserExporter{
+		Client: srv.Client(),
+		Format: convai.FormatJSONL,
+		Query:  &convai.UserQuery{Mode: convai.UQMAll, Limit: 2},
+	}
+
+	var buf bytes.Buffer
+	n, err := exporter.Export(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var user convai.SuperUser
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		seen[user.Data["name"].(string)] = true
+	}
+
+	if n != 5 || len(seen) != 5 {
+		t.Fatalf("expected each of the 5 users once, got %d lines with %d distinct users", n, len(seen))
+	}
+
+	pages := 0
+	for _, r := range srv.Requests() {
+		if r.Path == "/users/super/query" {
+			pages++
+		}
+	}
+
+	if pages < 3 {
+		t.Fatalf("expected the users to be fetched 2 at a time, got %d pages", pages)
+	}
+}
@@ -0,0 +1,433 @@
+package convai
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// RecordFormat is the file format used by the importer and exporter
+type RecordFormat string
+
+const (
+	FormatCSV   RecordFormat = "csv"
+	FormatJSONL RecordFormat = "jsonl"
+)
+
+// ChannelColumn maps a column holding channel IDs to the channel they belong to
+type ChannelColumn struct {
+	Channel string
+	Column  string
+}
+
+// ImportMapping describes how the columns of a row (CSV headers or JSON keys) map onto a user
+type ImportMapping struct {
+	// Data maps columns to user data keys. When nil, every column that is not used elsewhere
+	// in the mapping is stored under its own name
+	Data map[string]string
+
+	// Channels lists the columns that hold channel IDs, one channel user is created per non empty value
+	Channels []ChannelColumn
+
+	// SuperUserIDColumn, when set and non empty in a row, adds the row's channel users to that
+	// existing super user instead of creating a new one
+	SuperUserIDColumn string
+
+	// KeyColumn identifies rows in the report and checkpoint, the row number is used when it is not set or a row
+	// has no value in it. A row repeating the key of an earlier row fails
+	KeyColumn string
+}
+
+// UserImporter creates users in bulk from CSV or JSONL input
+type UserImporter struct {
+	Client        *Client
+	EnvironmentID uuid.UUID
+	Format        RecordFormat
+	Mapping       ImportMapping
+
+	// Workers is the number of rows imported concurrently, defaults to 4
+	Workers int
+
+	// CheckpointPath is a file recording the keys of imported rows. Rows found in it are skipped,
+	// so an interrupted import can be resumed by running it again with the same input
+	CheckpointPath string
+
+	// OnRow is called with the result of every row as it completes
+	OnRow func(result ImportRowResult)
+}
+
+// ImportRowResult is the outcome of importing a single row
+type ImportRowResult struct {
+	Row            int      `json:"row"`
+	Key            string   `json:"key"`
+	SuperUserID    string   `json:"superUserId,omitempty"`
+	ChannelUserIDs []string `json:"channelUserIds,omitempty"`
+	Skipped        bool     `json:"skipped,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import, with one entry per row in input order
+type ImportReport struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+type importRow struct {
+	number int
+	key    string
+	fields map[string]interface{}
+
+	// duplicateOf is the number of the earlier row with the same key
+	duplicateOf int
+}
+
+// Import reads every row from r and creates the users it describes
+// Failed rows are recorded in the report rather than stopping the import, an error is only returned
+// when the input cannot be read, the checkpoint cannot be used or ctx is done. Rows that were not imported
+// by the time ctx is done are left out of the report
+func (i *UserImporter) Import(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	done, err := loadCheckpoint(i.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint *os.File
+	if i.CheckpointPath != "" {
+		checkpoint, err = os.OpenFile(i.CheckpointPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		defer checkpoint.Close()
+	}
+
+	workers := i.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rows := make(chan importRow)
+	results := make(chan ImportRowResult)
+
+	var readErr error
+	go func() {
+		defer close(rows)
+		readErr = i.readRows(ctx, r, rows)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rows {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if row.duplicateOf > 0 {
+					results <- ImportRowResult{
+						Row:   row.number,
+						Key:   row.key,
+						Error: fmt.Sprintf("duplicate key %q, already used by row %d", row.key, row.duplicateOf),
+					}
+					continue
+				}
+
+				if done[row.key] {
+					results <- ImportRowResult{Row: row.number, Key: row.key, Skipped: true}
+					continue
+				}
+
+				res := i.importRow(ctx, row)
+
+				// A row that failed because the import was stopped did not fail on its own
+				if res.Error != "" && ctx.Err() != nil {
+					continue
+				}
+
+				results <- res
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+
+	var checkpointErr error
+	for res := range results {
+		report.Total++
+		switch {
+		case res.Skipped:
+			report.Skipped++
+		case res.Error != "":
+			report.Failed++
+		default:
+			report.Succeeded++
+
+			if checkpoint != nil && checkpointErr == nil {
+				if _, err := fmt.Fprintln(checkpoint, res.Key); err != nil {
+					checkpointErr = err
+					cancel()
+				}
+			}
+		}
+
+		report.Rows = append(report.Rows, res)
+
+		if i.OnRow != nil {
+			i.OnRow(res)
+		}
+	}
+
+	sort.Slice(report.Rows, func(a, b int) bool {
+		return report.Rows[a].Row < report.Rows[b].Row
+	})
+
+	if checkpointErr != nil {
+		return report, fmt.Errorf("writing checkpoint: %w", checkpointErr)
+	}
+
+	if readErr != nil {
+		return report, readErr
+	}
+
+	return report, ctx.Err()
+}
+
+func (i *UserImporter) importRow(ctx context.Context, row importRow) ImportRowResult {
+	res := ImportRowResult{Row: row.number, Key: row.key}
+
+	// Every row creates different users, so each needs its own key
+	ctx = deriveIdempotencyKey(ctx, "row-"+row.key)
+
+	channelUsers := i.channelUsers(row.fields)
+
+	if i.Mapping.SuperUserIDColumn != "" {
+		if id := fieldString(row.fields[i.Mapping.SuperUserIDColumn]); id != "" {
+			superUserID, err := uuid.FromString(id)
+			if err != nil {
+				res.Error = fmt.Sprintf("invalid super user id %q: %s", id, err.Error())
+				return res
+			}
+
+			created, err := i.Client.CreateChannelUsersWithContext(ctx, &CreateChannelUsersRequest{
+				EnvironmentID: i.EnvironmentID,
+				SuperUserID:   superUserID,
+				ChannelUsers:  channelUsers,
+			})
+			if err != nil {
+				res.Error = err.Error()
+				return res
+			}
+
+			res.SuperUserID = superUserID.String()
+			res.ChannelUserIDs = created.ChannelUserIDs
+			return res
+		}
+	}
+
+	created, err := i.Client.CreateSuperUserWithContext(ctx, &CreateCombinedUserRequest{
+		EnvironmentID: i.EnvironmentID,
+		UserData:      i.userData(row.fields),
+		ChannelUsers:  channelUsers,
+	})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.SuperUserID = created.SuperUserID.String()
+	res.ChannelUserIDs = created.ChannelUserIDs
+	return res
+}
+
+func (i *UserImporter) userData(fields map[string]interface{}) UserData {
+	data := UserData{}
+
+	if i.Mapping.Data != nil {
+		for column, key := range i.Mapping.Data {
+			if v, ok := fields[column]; ok {
+				data[key] = v
+			}
+		}
+
+		return data
+	}
+
+	used := map[string]bool{
+		i.Mapping.SuperUserIDColumn: true,
+	}
+	for _, cc := range i.Mapping.Channels {
+		used[cc.Column] = true
+	}
+
+	for column, v := range fields {
+		if !used[column] {
+			data[column] = v
+		}
+	}
+
+	return data
+}
+
+func (i *UserImporter) channelUsers(fields map[string]interface{}) []CreateChannelUser {
+	users := []CreateChannelUser{}
+
+	for _, cc := range i.Mapping.Channels {
+		id := fieldString(fields[cc.Column])
+		if id == "" {
+			continue
+		}
+
+		users = append(users, CreateChannelUser{
+			Channel:   cc.Channel,
+			ChannelID: id,
+		})
+	}
+
+	return users
+}
+
+// readRows parses r according to the importer's format and sends each row to rows
+func (i *UserImporter) readRows(ctx context.Context, r io.Reader, rows chan<- importRow) error {
+	seen := make(map[string]int)
+
+	emit := func(number int, fields map[string]interface{}) error {
+		key := strconv.Itoa(number)
+		if i.Mapping.KeyColumn != "" {
+			// A blank key would never be found in the checkpoint, so the row would be imported again on every run
+			// The row number stands in for it, prefixed so that it cannot collide with a key from the input
+			key = "#row-" + key
+			if value := strings.TrimSpace(fieldString(fields[i.Mapping.KeyColumn])); value != "" {
+				key = value
+			}
+		}
+
+		row := importRow{number: number, key: key, fields: fields, duplicateOf: seen[key]}
+		if row.duplicateOf == 0 {
+			seen[key] = number
+		}
+
+		select {
+		case rows <- row:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	switch i.Format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+
+		header, err := cr.Read()
+		if err != nil {
+			return fmt.Errorf("reading csv header: %w", err)
+		}
+
+		for number := 1; ; number++ {
+			record, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("reading csv row %d: %w", number, err)
+			}
+
+			fields := make(map[string]interface{}, len(header))
+			for c, column := range header {
+				if c < len(record) {
+					fields[column] = record[c]
+				}
+			}
+
+			if err := emit(number, fields); err != nil {
+				return err
+			}
+		}
+
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		for number := 1; scanner.Scan(); number++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			// Numbers are kept as json.Number so that numeric IDs are not mangled into floats
+			dec := json.NewDecoder(strings.NewReader(line))
+			dec.UseNumber()
+
+			var fields map[string]interface{}
+			if err := dec.Decode(&fields); err != nil {
+				return fmt.Errorf("reading jsonl row %d: %w", number, err)
+			}
+
+			if err := emit(number, fields); err != nil {
+				return err
+			}
+		}
+
+		return scanner.Err()
+	}
+
+	return fmt.Errorf("unsupported import format %q", i.Format)
+}
+
+// loadCheckpoint reads the keys of rows that were already imported
+func loadCheckpoint(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if path == "" {
+		return done, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			done[key] = true
+		}
+	}
+
+	return done, scanner.Err()
+}
+
+func fieldString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(s)
+	default:
+		return fmt.Sprint(s)
+	}
+}
@@ -0,0 +1,96 @@
+package convai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	convai "github.com/datomar-labs-inc/convai-sdk-go"
+	"github.com/datomar-labs-inc/convai-sdk-go/convaitest"
+)
+
+func TestImportKeys(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	importer := &convai.UserImporter{
+		Client: srv.Client(),
+		Format: convai.FormatCSV,
+		Mapping: convai.ImportMapping{
+			Channels:  []convai.ChannelColumn{{Channel: "sms", Column: "phone"}},
+			KeyColumn: "email",
+		},
+		CheckpointPath: filepath.Join(dir, "checkpoint"),
+	}
+
+	// Row 2 has no key, row 3 has a key that looks like a row number and row 4 repeats row 1
+	input := "email,phone\na@example.com,1\n,2\n2,3\na@example.com,4\n"
+
+	report, err := importer.Import(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Succeeded != 3 || report.Failed != 1 {
+		t.Fatalf("expected 3 rows to succeed and the duplicate to fail, got %+v", report)
+	}
+
+	if key := report.Rows[1].Key; key != "#row-2" {
+		t.Fatalf("expected a row without a key to fall back to its number, got %q", key)
+	}
+
+	if row := report.Rows[3]; !strings.Contains(row.Error, "duplicate key") {
+		t.Fatalf("expected row 4 to fail as a duplicate, got %+v", row)
+	}
+
+	// Resuming skips both imported rows, including the one keyed by its row number
+	report, err = importer.Import(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Skipped != 3 || report.Failed != 1 {
+		t.Fatalf("expected 3 rows to be skipped and the duplicate to fail, got %+v", report)
+	}
+
+	if users := srv.SuperUsers(); len(users) != 3 {
+		t.Fatalf("expected 3 users to be created, got %d", len(users))
+	}
+}
+
+func TestImportLeavesOutRowsAfterCancel(t *testing.T) {
+	srv := convaitest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop the import as soon as the first user is being created
+	srv.SetFailureHook(func(r *http.Request) (int, bool) {
+		cancel()
+		return 0, false
+	})
+
+	importer := &convai.UserImporter{
+		Client:  srv.Client(),
+		Format:  convai.FormatCSV,
+		Mapping: convai.ImportMapping{Channels: []convai.ChannelColumn{{Channel: "sms", Column: "phone"}}},
+		Workers: 1,
+	}
+
+	report, err := importer.Import(ctx, strings.NewReader("phone\n1\n2\n3\n4\n5\n"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the import to be canceled, got %v", err)
+	}
+
+	if report.Failed != 0 || report.Total > 1 {
+		t.Fatalf("expected the rows after the cancel to be left out, got %+v", report)
+	}
+}